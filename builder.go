@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
+	"sort"
 )
 
 // ActionMap
@@ -18,12 +20,30 @@ type Builder struct {
 	actions ActionMap
 	fstr    *Structure
 	err     *FsmError
+	logger  *slog.Logger
 }
 
 // NewBuilder
 // Constructs new builder
 func NewBuilder(actions ActionMap) *Builder {
-	return &Builder{actions, NewStructure(), nil}
+	return &Builder{actions, NewStructure(), nil, nil}
+}
+
+// WithLogger
+// Makes builder log structure loading diagnostics (states loaded at debug level,
+// loading errors at error level). Constructed FSMs get the logger by default (see WithLogger option)
+func (bld *Builder) WithLogger(logger *slog.Logger) *Builder {
+	bld.logger = logger
+	return bld
+}
+
+// fsmOptions
+// Prepends builder defaults to given FSM options, so the latter take precedence
+func (bld *Builder) fsmOptions(options []FsmOption) []FsmOption {
+	if bld.logger == nil {
+		return options
+	}
+	return append([]FsmOption{WithLogger(bld.logger)}, options...)
 }
 
 // Structure
@@ -45,12 +65,23 @@ func (bld *Builder) Structure() (fstr *Structure, err *FsmError) {
 
 // Fsm
 // Returns state machine object, constructed from the structure
-func (bld *Builder) Fsm() (fsm *Fsm, err *FsmError) {
+func (bld *Builder) Fsm(options ...FsmOption) (fsm *Fsm, err *FsmError) {
+	fstr, err := bld.Structure()
+	if err != nil {
+		return
+	}
+	fsm = NewFsm(fstr, bld.fsmOptions(options)...)
+	return
+}
+
+// SyncFsm
+// Returns goroutine-safe state machine object, constructed from the structure
+func (bld *Builder) SyncFsm(options ...FsmOption) (fsm *SyncFsm, err *FsmError) {
 	fstr, err := bld.Structure()
 	if err != nil {
 		return
 	}
-	fsm = NewFsm(fstr)
+	fsm = NewSyncFsm(fstr, bld.fsmOptions(options)...)
 	return
 }
 
@@ -80,13 +111,33 @@ func (bld *Builder) FromJsonFile(path string) *Builder {
 //     "states": {                             -- required key name for state list
 //         "0": {                              -- no parent key implies global parent (topmost state)
 //             "start": true,                  -- indicates FSM entry point, should be exactly 1
-//             "startsub": "1"                 -- parent state can't have custom transitions, only start substate
+//             "startsub": "1",                -- parent state is entered via start substate, its own transitions
+//                                             -- (if any) are considered while any of its substates is active
+//             "history": "deep",              -- optional, "shallow" or "deep", enables "0#history" transition target
+//             "historycontext": true          -- optional, remembered sub states get their contexts back
 //         },
 //         "1": {
 //             "parent": "0",                  -- empty parent means top level state
-//             "transitions": {
+//             "onenter": {                    -- optional state entry action (same format as transition action)
+//                 "name": "prepare"
+//             },
+//             "onexit": {                     -- optional state exit action
+//                 "name": "cleanup"
+//             },
+//             "compensate": {                 -- optional action undoing state entry (see Fsm.Compensate)
+//                 "name": "release"
+//             },
+//             "onerror": {                    -- optional, taken when guard/action fails (see FsmErrorCtxMemberName)
+//                 "1-3": {                    -- unhandled failures are passed to parent state, then FSM goes fatal
+//                     "to": "3"
+//                 }
+//             },
+//             "transitions": {                -- either an object (keys are names) or an array (see below)
 //                 "1-2": {
-//                     "to": "2",              -- transition target, should be in the same level of hierarchy
+//                     "to": "2",              -- transition target, any state of the same region, "<state>#history" for history
+//                     "on": "next",           -- optional event name, transition is only considered by Fsm.Fire
+//                     "priority": 1,          -- optional priority, used by ConflictFirstMatch policy
+//                     "kind": "external",     -- optional, "internal" self-transition doesn't leave the state
 //                     "guard": {              -- no guard key implies unconditional transition
 //                         "type": "always"    -- can be either unconditional or conditional (see below)
 //                     },
@@ -94,7 +145,17 @@ func (bld *Builder) FromJsonFile(path string) *Builder {
 //                         "name": "setnext",  -- action key should be present in builder's ActionMap
 //                         "params": {         -- optional parameter list (see PackagedAction for more info)
 //	                           "key": 42       -- parameters may have one of json types
+//                         },
+//                         "retry": {          -- optional retry policy (see RetryPolicy)
+//                             "attempts": 3,  -- first attempt included
+//                             "backoff": "exponential",
+//                             "delay": "100ms",
+//                             "maxdelay": "1s",
+//                             "on": ["busy"]  -- error classes to retry (see Classify), empty means any error
 //                         }
+//                     },
+//                     "compensate": {         -- optional action undoing the transition action
+//                         "name": "unsetnext"
 //                     }
 //                 }
 //             }
@@ -113,6 +174,38 @@ func (bld *Builder) FromJsonFile(path string) *Builder {
 //             }
 //         },
 //         "3": {
+//             "parent": "0",
+//             "transitions": [                -- ordered form, declaration order is used when priorities are equal
+//                 {"name": "3-4", "to": "4", "guard": {"type": "context", "key": "next", "value": 4}},
+//                 {"name": "3-3c", "to": "3c"}
+//             ]
+//         },
+//         "3c": {
+//             "parent": "0",
+//             "pseudo": "choice",             -- "choice" or "junction" pseudo-state, passed within the same step
+//             "transitions": [                -- exactly one of pseudo-state transitions should be an else branch
+//                 {"name": "3c-4", "to": "4", "guard": {"type": "context", "key": "next", "value": 4}},
+//                 {"name": "3c-5", "to": "5", "else": true}
+//             ]
+//         },
+//         "4": {
+//             "parent": "0",
+//             "regions": {                    -- parallel state, regions progress independently
+//                 "4a": {                     -- region name, region states use it as a parent
+//                     "startsub": "41"        -- every region should have a start sub state
+//                 },
+//                 "4b": {
+//                     "startsub": "42"        -- "41", "42" and their siblings are usual states with "4a"/"4b" parents
+//                 }
+//             },
+//             "ondone": {                     -- parallel state is left when all regions reach final states,
+//                                             -- composite state - when its sub state is final
+//                 "4-5": {
+//                     "to": "5"
+//                 }
+//             }
+//         },
+//         "5": {
 //             "parent": "0"                   -- no transitions means final state (FSM will be considered completed)
 //         }
 //     }
@@ -145,7 +238,7 @@ func (bld *Builder) FromJsonType(root JsonRoot) *Builder {
 		return bld
 	}
 
-	start, list, err := buildStateHierarchy(jsStates, bld.actions)
+	start, list, err := buildStateHierarchy(jsStates, bld.actions, bld.logger)
 	switch {
 	case err != nil:
 		bld.err = err
@@ -154,12 +247,16 @@ func (bld *Builder) FromJsonType(root JsonRoot) *Builder {
 	case len(list) == 0:
 		bld.err = newFsmErrorLoading("State machine is empty")
 	}
-	if bld.err != nil {
-		return bld
+	if bld.err == nil {
+		bld.err = bld.fstr.appendStates(start, list)
 	}
 
-	bld.err = bld.fstr.appendStates(start, list)
-
+	if bld.err != nil {
+		logLoading(bld.logger, slog.LevelError, "structure loading failed", errorAttrs(bld.err)...)
+	} else {
+		logLoading(bld.logger, slog.LevelInfo, "structure loaded",
+			slog.String("start", start.Name), slog.Int("states", len(list)+1))
+	}
 	return bld
 }
 
@@ -178,17 +275,23 @@ type depStates map[string]*StateInfo
 // Json doesn't constrain states in any way so they could be in any order.
 // So input json states need to be traversed from topmost parents to downmost children to make a proper structure.
 // Additionally this method scans json state list for several logic/format errors
-func buildStateHierarchy(states JsonStates, actions ActionMap) (start *StateInfo, list depStates, err *FsmError) {
+// States are processed in name order and regions are added in name order, so the result is the same on every load
+// States are logged as they are added to the hierarchy (if logger is given)
+func buildStateHierarchy(states JsonStates, actions ActionMap, logger *slog.Logger) (start *StateInfo, list depStates, err *FsmError) {
+	if states, err = prepareStates(states); err != nil {
+		return
+	}
 	count := len(states)
 
 	// map state indexes to names
-	names := make([]string, count)
+	names := make([]string, 0, count)
 	indexes := make(map[string]int)
-	var idx int
 	for k, _ := range states {
-		names[idx] = k
-		indexes[k] = idx
-		idx++
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for idx, name := range names {
+		indexes[name] = idx
 	}
 
 	// build dependency graph
@@ -208,14 +311,19 @@ func buildStateHierarchy(states JsonStates, actions ActionMap) (start *StateInfo
 			j := indexes[name]
 			graph[i][j] = true
 		}
+		// every region depends on the previous one, so they're added in order
+		regions := state.regionNames()
+		for k := 1; k < len(regions); k++ {
+			graph[indexes[regions[k]]][indexes[regions[k-1]]] = true
+		}
 	}
 
 	// satisfy dependencies of every state
 	list = make(depStates)
 	markers := make(depMarkers, count)
 
-	for _, idx := range indexes {
-		err = satisfyDependencies(idx, graph, markers, names, states, actions, &start, list)
+	for idx := range names {
+		err = satisfyDependencies(idx, graph, markers, names, states, actions, logger, &start, list)
 		if err != nil {
 			break
 		}
@@ -224,6 +332,47 @@ func buildStateHierarchy(states JsonStates, actions ActionMap) (start *StateInfo
 	return
 }
 
+// prepareStates
+// Returns a copy of json states with regions of parallel states turned into
+// separate states and start sub states marked as such
+func prepareStates(source JsonStates) (states JsonStates, err *FsmError) {
+	states = make(JsonStates, len(source))
+	for name, state := range source {
+		states[name] = state
+	}
+
+	for name, state := range source {
+		for _, regionName := range state.regionNames() {
+			region := state.Regions[regionName]
+			if _, found := states[regionName]; found {
+				cause := fmt.Sprintf("Region name (%s) of state (%s) is already used", regionName, name)
+				return nil, newFsmErrorLoading(cause)
+			}
+			states[regionName] = JsonState{
+				StartSubState: region.StartSubState,
+				Parent:        name,
+				OnEnter:       region.OnEnter,
+				OnExit:        region.OnExit,
+				region:        true,
+			}
+		}
+	}
+
+	for name, state := range states {
+		if len(state.StartSubState) == 0 {
+			continue
+		}
+		sub, found := states[state.StartSubState]
+		if !found {
+			cause := fmt.Sprintf("Start sub state (%s) of state (%s) is not defined", state.StartSubState, name)
+			return nil, newFsmErrorLoading(cause)
+		}
+		sub.startSub = true
+		states[state.StartSubState] = sub
+	}
+	return
+}
+
 // satisfyDependencies
 // Recursively adds given state parents to the hierarcy
 // Detects errors such as state dependency cycles or >1 entry points
@@ -234,6 +383,7 @@ func satisfyDependencies(
 	names []string, // state index to name mapping
 	source JsonStates, // map of states unmarshalled from json
 	actions ActionMap, // state actions for creation of StateInfo objects
+	logger *slog.Logger, // (optional) logger to report added states to
 	start **StateInfo, // (out) start StateInfo object (FSM entry point)
 	dest depStates, // (out) result map containing StateInfo objects in proper hierarchy
 ) *FsmError {
@@ -253,7 +403,7 @@ func satisfyDependencies(
 
 	for on, depends := range graph[index] {
 		if depends {
-			err := satisfyDependencies(on, graph, markers, names, source, actions, start, dest)
+			err := satisfyDependencies(on, graph, markers, names, source, actions, logger, start, dest)
 			if err != nil {
 				return err
 			}
@@ -285,6 +435,13 @@ func satisfyDependencies(
 		return err
 	}
 
+	logLoading(logger, slog.LevelDebug, "state loaded",
+		slog.String("state", name),
+		slog.String("parent", parentName),
+		slog.Bool("start", source[name].Start),
+		slog.Int("transitions", len(si.Transitions)),
+	)
+
 	if source[name].Start {
 		if *start != nil {
 			cause := fmt.Sprintf("Several start states defined (%s, %s)", (*start).Name, si.Name)
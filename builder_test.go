@@ -1,6 +1,7 @@
 package simple_fsm
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -12,12 +13,12 @@ type pC struct {
 
 func makeJsonStates(start pC, pcs ...pC) JsonStates {
 	js := make(JsonStates)
-	trm := make(map[string]JsonTransition)
+	var trm JsonTransitions
 
-	js[start.state] = JsonState{true, start.ssub, "", trm}
+	js[start.state] = JsonState{Start: true, StartSubState: start.ssub, Transitions: trm}
 
 	for _, pc := range pcs {
-		js[pc.state] = JsonState{false, pc.ssub, pc.parent, trm}
+		js[pc.state] = JsonState{StartSubState: pc.ssub, Parent: pc.parent, Transitions: trm}
 	}
 	return js
 }
@@ -39,7 +40,7 @@ func TestBuildStateHierarchyPositive1(t *testing.T) {
 		pC{"2", "", ""},
 	)
 
-	start, list, err := buildStateHierarchy(js, ActionMap{})
+	start, list, err := buildStateHierarchy(js, ActionMap{}, nil)
 	if err != nil {
 		t.Logf("Hierarchy building unexpectedly failed: %s", err.Error())
 		t.FailNow()
@@ -62,7 +63,7 @@ func TestBuildStateHierarchyPositive2(t *testing.T) {
 		pC{"2", "0", ""},
 	)
 
-	start, list, err := buildStateHierarchy(js, ActionMap{})
+	start, list, err := buildStateHierarchy(js, ActionMap{}, nil)
 	if err != nil {
 		t.Logf("Hierarchy building unexpectedly failed: %s", err.Error())
 		t.FailNow()
@@ -89,7 +90,7 @@ func TestBuildStateHierarchyPositive3(t *testing.T) {
 		pC{"22", "1", ""},
 	)
 
-	start, list, err := buildStateHierarchy(js, ActionMap{})
+	start, list, err := buildStateHierarchy(js, ActionMap{}, nil)
 	if err != nil {
 		t.Logf("Hierarchy building unexpectedly failed: %s", err.Error())
 		t.FailNow()
@@ -117,7 +118,7 @@ func TestBuildStateHierarchyCycled(t *testing.T) {
 		pC{"3", "2", "0"},
 	)
 
-	_, _, err := buildStateHierarchy(js, ActionMap{})
+	_, _, err := buildStateHierarchy(js, ActionMap{}, nil)
 	if err == nil || err.Kind() != ErrFsmLoading {
 		t.Log("Hierarchy building is expected to fail (state hierarchy cycled)")
 		t.FailNow()
@@ -131,9 +132,9 @@ func TestBuildStateSeveralEntryPoints(t *testing.T) {
 		pC{"2", "1", "3"},
 		pC{"3", "2", ""},
 	)
-	js["4"] = JsonState{true, "", "2", nil}
+	js["4"] = JsonState{Start: true, Parent: "2"}
 
-	_, _, err := buildStateHierarchy(js, ActionMap{})
+	_, _, err := buildStateHierarchy(js, ActionMap{}, nil)
 	if err == nil || err.Kind() != ErrFsmLoading {
 		t.Log("Hierarchy building is expected to fail (several entry points)")
 		t.FailNow()
@@ -178,3 +179,88 @@ func TestBuilderFromJsonFile(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestBuilderParallelRegions(t *testing.T) {
+	rawJson := `
+	{
+		"states": {
+			"checkout": {
+				"start": true,
+				"regions": {
+					"payment": {"startsub": "unpaid"},
+					"shipping": {"startsub": "packing"}
+				},
+				"ondone": {
+					"checkout-finished": {"to": "finished", "action": {"name": "finish"}}
+				}
+			},
+			"unpaid": {"parent": "payment", "transitions": {"unpaid-paid": {"to": "paid"}}},
+			"paid": {"parent": "payment"},
+			"packing": {"parent": "shipping", "transitions": {"packing-shipped": {"to": "shipped"}}},
+			"shipped": {"parent": "shipping"},
+			"finished": {}
+		}
+	}`
+	actions := ActionMap{"finish": func(ctx ContextOperator) error { ctx.PutResult(42); return nil }}
+
+	fsm, err := NewBuilder(actions).FromRawJson([]byte(rawJson)).Fsm()
+	if err != nil {
+		t.Logf("Structure construction failed, %s", err.Error())
+		t.FailNow()
+	}
+	if res, err := fsm.Run(); err != nil || res != 42 {
+		t.Logf("Loaded FSM execution failed: %v", err)
+		t.Logf("State machine dump:\n%s", Dump(fsm))
+		t.FailNow()
+	}
+
+	rawJson = `
+	{
+		"states": {
+			"checkout": {"start": true, "regions": {"payment": {"startsub": "unpaid"}}},
+			"payment": {"parent": "checkout"},
+			"unpaid": {"parent": "payment"}
+		}
+	}`
+	if _, err := NewBuilder(actions).FromRawJson([]byte(rawJson)).Fsm(); err == nil || err.Kind() != ErrFsmLoading {
+		t.Log("Loading should fail (region name is already used)")
+		t.FailNow()
+	}
+}
+
+func TestBuilderRegionOrder(t *testing.T) {
+	rawJson := `
+	{
+		"states": {
+			"checkout": {
+				"start": true,
+				"regions": {
+					"shipping": {"startsub": "packing"},
+					"invoicing": {"startsub": "drafted"},
+					"payment": {"startsub": "unpaid"}
+				}
+			},
+			"unpaid": {"parent": "payment"},
+			"packing": {"parent": "shipping"},
+			"drafted": {"parent": "invoicing"}
+		}
+	}`
+	expected := []string{"invoicing", "payment", "shipping"}
+
+	// map iteration order is random, so several loads are made
+	for i := 0; i < 20; i++ {
+		fstr, err := NewBuilder(ActionMap{}).FromRawJson([]byte(rawJson)).Structure()
+		if err != nil {
+			t.Logf("Structure construction failed, %s", err.Error())
+			t.FailNow()
+		}
+		var names []string
+		for _, region := range fstr.states["checkout"].Regions {
+			names = append(names, region.Name)
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Logf("Regions should be ordered by name: %v", names)
+			t.FailNow()
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package simple_fsm
+
+import (
+	"time"
+)
+
+// Clock
+// Source of time for FSM: timestamps and waiting between action attempts
+// Can be replaced (see WithClock) to make timing deterministic in tests
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock
+// Clock backed by the standard time package
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
@@ -0,0 +1,243 @@
+package simple_fsm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+const (
+	CodecNil   = "nil"
+	CodecError = "error"
+)
+
+// ValueCodec
+// Converts context values of some type to JSON and back (see Snapshot)
+type ValueCodec interface {
+	Encode(value interface{}) (json.RawMessage, error)
+	Decode(raw json.RawMessage) (interface{}, error)
+}
+
+// jsonCodec
+// Codec relying on encoding/json, values are decoded to the type of a sample
+type jsonCodec struct {
+	typ reflect.Type
+}
+
+// NewJsonCodec
+// Constructs a codec for values having the same type as sample,
+// encoding/json is used for conversion
+func NewJsonCodec(sample interface{}) ValueCodec {
+	return jsonCodec{typ: reflect.TypeOf(sample)}
+}
+
+func (jc jsonCodec) Encode(value interface{}) (json.RawMessage, error) {
+	return json.Marshal(value)
+}
+
+func (jc jsonCodec) Decode(raw json.RawMessage) (interface{}, error) {
+	ptr := reflect.New(jc.typ)
+	if err := json.Unmarshal(raw, ptr.Interface()); err != nil {
+		return nil, err
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+// errorCodec
+// Codec keeping error messages only, decoded errors are plain ones
+type errorCodec struct{}
+
+func (ec errorCodec) Encode(value interface{}) (json.RawMessage, error) {
+	return json.Marshal(value.(error).Error())
+}
+
+func (ec errorCodec) Decode(raw json.RawMessage) (interface{}, error) {
+	var msg string
+	if err := json.Unmarshal(raw, &msg); err != nil {
+		return nil, err
+	}
+	return errors.New(msg), nil
+}
+
+// listCodec, mapCodec
+// Codecs of []interface{} and map[string]interface{}: every element is encoded
+// by the registry along with its codec name, so element types are kept
+// (e.g. int elements are not turned into float64 ones); elements without codecs are not encoded
+type listCodec struct {
+	codecs *ValueCodecs
+}
+type mapCodec struct {
+	codecs *ValueCodecs
+}
+
+func (lc listCodec) Encode(value interface{}) (json.RawMessage, error) {
+	list := value.([]interface{})
+	elems := make([]SnapshotValue, len(list))
+	for idx, elem := range list {
+		sv, err := lc.codecs.encode(strconv.Itoa(idx), elem)
+		if err != nil {
+			return nil, err
+		}
+		elems[idx] = sv
+	}
+	return json.Marshal(elems)
+}
+
+func (lc listCodec) Decode(raw json.RawMessage) (interface{}, error) {
+	var elems []SnapshotValue
+	if err := json.Unmarshal(raw, &elems); err != nil {
+		return nil, err
+	}
+	list := make([]interface{}, len(elems))
+	for idx, sv := range elems {
+		elem, err := lc.codecs.decode(strconv.Itoa(idx), sv)
+		if err != nil {
+			return nil, err
+		}
+		list[idx] = elem
+	}
+	return list, nil
+}
+
+func (mc mapCodec) Encode(value interface{}) (json.RawMessage, error) {
+	elems := make(map[string]SnapshotValue)
+	for k, elem := range value.(map[string]interface{}) {
+		sv, err := mc.codecs.encode(k, elem)
+		if err != nil {
+			return nil, err
+		}
+		elems[k] = sv
+	}
+	return json.Marshal(elems)
+}
+
+func (mc mapCodec) Decode(raw json.RawMessage) (interface{}, error) {
+	var elems map[string]SnapshotValue
+	if err := json.Unmarshal(raw, &elems); err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{}, len(elems))
+	for k, sv := range elems {
+		elem, err := mc.codecs.decode(k, sv)
+		if err != nil {
+			return nil, err
+		}
+		m[k] = elem
+	}
+	return m, nil
+}
+
+// ValueCodecs
+// Registry of named value codecs
+// Codec is chosen by value type when a value is encoded
+// and by the name stored along with the value when it's decoded
+// Values implementing error interface fall back to CodecError
+// Built-in codecs cover bool, int, int64, float64, string,
+// []interface{}, map[string]interface{}, time.Time and time.Duration
+// Elements of lists and maps are encoded by the registry as well (see listCodec)
+type ValueCodecs struct {
+	byName map[string]ValueCodec
+	byType map[reflect.Type]string
+}
+
+// NewValueCodecs
+// Constructs a registry containing built-in codecs
+func NewValueCodecs() *ValueCodecs {
+	vc := &ValueCodecs{
+		byName: map[string]ValueCodec{CodecError: errorCodec{}},
+		byType: make(map[reflect.Type]string),
+	}
+	for name, sample := range map[string]interface{}{
+		"bool":     false,
+		"int":      0,
+		"int64":    int64(0),
+		"float":    float64(0),
+		"string":   "",
+		"time":     time.Time{},
+		"duration": time.Duration(0),
+	} {
+		vc.Register(name, sample, NewJsonCodec(sample))
+	}
+	vc.Register("list", []interface{}{}, listCodec{vc})
+	vc.Register("map", map[string]interface{}{}, mapCodec{vc})
+	return vc
+}
+
+// builtinCodecs
+// Registry used by FSM unless another one is set (see WithValueCodecs)
+var builtinCodecs = NewValueCodecs()
+
+// Register
+// Adds a codec for values having the same type as sample
+// Registered name is stored in snapshots, so it should stay the same
+func (vc *ValueCodecs) Register(name string, sample interface{}, codec ValueCodec) *FsmError {
+	switch {
+	case name == "" || name == CodecNil || name == CodecError:
+		return newFsmErrorInvalid(fmt.Sprintf("codec name \"%s\" is reserved", name))
+	case sample == nil || codec == nil:
+		return newFsmErrorInvalid(fmt.Sprintf("codec \"%s\" should have a sample value and a codec", name))
+	}
+	if _, present := vc.byName[name]; present {
+		return newFsmErrorInvalid(fmt.Sprintf("codec \"%s\" is already registered", name))
+	}
+	vc.byName[name] = codec
+	vc.byType[reflect.TypeOf(sample)] = name
+	return nil
+}
+
+// encode
+// Converts a context value to its snapshot representation
+func (vc *ValueCodecs) encode(key string, value interface{}) (sv SnapshotValue, err *FsmError) {
+	if value == nil {
+		sv.Type = CodecNil
+		return
+	}
+
+	name, present := vc.byType[reflect.TypeOf(value)]
+	if !present {
+		if _, isError := value.(error); !isError {
+			err = newFsmErrorSnapshot(fmt.Sprintf("no codec for \"%s\" of type %T", key, value))
+			return
+		}
+		name = CodecError
+	}
+
+	raw, e := vc.byName[name].Encode(value)
+	if e != nil {
+		err = newFsmErrorSnapshot(fmt.Sprintf("encoding \"%s\" failed: %s", key, e.Error()))
+		return
+	}
+	sv = SnapshotValue{Type: name, Value: raw}
+	return
+}
+
+// decode
+// Converts snapshot representation back to a context value
+func (vc *ValueCodecs) decode(key string, sv SnapshotValue) (value interface{}, err *FsmError) {
+	if sv.Type == CodecNil {
+		return
+	}
+
+	codec, present := vc.byName[sv.Type]
+	if !present {
+		err = newFsmErrorSnapshot(fmt.Sprintf("unknown codec \"%s\" of \"%s\"", sv.Type, key))
+		return
+	}
+
+	var e error
+	if value, e = codec.Decode(sv.Value); e != nil {
+		err = newFsmErrorSnapshot(fmt.Sprintf("decoding \"%s\" failed: %s", key, e.Error()))
+	}
+	return
+}
+
+// WithValueCodecs
+// Replaces built-in codecs used to snapshot context values (see NewValueCodecs)
+func WithValueCodecs(codecs *ValueCodecs) FsmOption {
+	return func(fsm *Fsm) {
+		fsm.codecs = codecs
+	}
+}
@@ -0,0 +1,77 @@
+package simple_fsm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValueCodecsRegister(t *testing.T) {
+	codecs := NewValueCodecs()
+	for _, name := range []string{"", CodecNil, CodecError, "int"} {
+		if err := codecs.Register(name, point{}, NewJsonCodec(point{})); err == nil {
+			t.Logf("Codec name \"%s\" should not be registered", name)
+			t.FailNow()
+		}
+	}
+	if err := codecs.Register("point", nil, NewJsonCodec(point{})); err == nil {
+		t.Log("Codec without a sample should not be registered")
+		t.FailNow()
+	}
+	if err := codecs.Register("point", point{}, NewJsonCodec(point{})); err != nil {
+		t.Logf("Codec should be registered: %v", err)
+		t.FailNow()
+	}
+}
+
+func TestValueCodecsBuiltin(t *testing.T) {
+	codecs := NewValueCodecs()
+	for _, value := range []interface{}{
+		true, 1, int64(2), 3.5, "str",
+		[]interface{}{"a", 1.0},
+		map[string]interface{}{"k": "v"},
+		time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		time.Second,
+	} {
+		sv, err := codecs.encode("key", value)
+		if err != nil {
+			t.Logf("Built-in value %#v should be encoded: %v", value, err)
+			t.FailNow()
+		}
+		decoded, err := codecs.decode("key", sv)
+		if err != nil || Dump(&Context{members: map[string]interface{}{"v": decoded}}) !=
+			Dump(&Context{members: map[string]interface{}{"v": value}}) {
+			t.Logf("Built-in value %#v should be decoded as is, got %#v (error: %v)", value, decoded, err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestValueCodecsNested(t *testing.T) {
+	codecs := NewValueCodecs()
+	codecs.Register("point", point{}, NewJsonCodec(point{}))
+
+	value := map[string]interface{}{
+		"items": []interface{}{1, int64(2), "three", nil, point{4, 5}},
+		"total": map[string]interface{}{"amount": 42, "paid": time.Second},
+	}
+	sv, err := codecs.encode("order", value)
+	if err != nil {
+		t.Logf("Nested value should be encoded: %v", err)
+		t.FailNow()
+	}
+	decoded, err := codecs.decode("order", sv)
+	if err != nil || !reflect.DeepEqual(decoded, value) {
+		t.Logf("Nested values should keep their types, got %#v (error: %v)", decoded, err)
+		t.FailNow()
+	}
+
+	if _, err = codecs.encode("order", []interface{}{1, struct{}{}}); err == nil || err.Kind() != ErrFsmSnapshot {
+		t.Log("List element without a codec should not be encoded")
+		t.FailNow()
+	}
+	if _, err = codecs.encode("order", map[string]interface{}{"k": struct{}{}}); err == nil || err.Kind() != ErrFsmSnapshot {
+		t.Log("Map element without a codec should not be encoded")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,83 @@
+package simple_fsm
+
+// CompensationOutcome
+// Result of a compensating action executed by FSM (see Fsm.Compensate)
+// Step is an index of the compensated history item,
+// -1 means the step that failed before it was logged
+type CompensationOutcome struct {
+	Step int
+	Name string
+	Err  error
+}
+
+// compensation
+// Compensating action of an executed transition action or an entered state
+// Transition compensations refer to the state declaring the transition
+type compensation struct {
+	name   string
+	source *StateInfo
+	action *PackagedAction
+}
+
+// owner
+// Returns the state compensating action was registered by
+func (c *compensation) owner(structure *Structure) *StateInfo {
+	if c.source != nil {
+		return c.source
+	}
+	return structure.states[c.name]
+}
+
+// pending
+// Describes the compensation by names of the state and transition it belongs to
+func (c *compensation) pending() PendingCompensation {
+	if c.source == nil {
+		return PendingCompensation{State: c.name}
+	}
+	return PendingCompensation{State: c.source.Name, Transition: c.name}
+}
+
+// Compensate
+// Undoes side effects of the run: compensating actions of entered states and
+// taken transitions are executed in reverse history order, each one only once.
+// FSM does it automatically when it goes fatal. FSM status is not changed.
+// Failed compensations don't stop the process, the first failure is returned
+// All outcomes are available via Compensations()
+func (fsm *Fsm) Compensate() (err *FsmError) {
+	defer func(finish func(*FsmError)) { finish(err) }(fsm.recordCall(RecordedCompensate, "", nil))
+	if fsm.Idle() {
+		return newFsmErrorWrongFlow("compensate", "idle")
+	}
+	return fsm.compensate()
+}
+
+// compensate
+// Executes pending compensating actions (see Compensate)
+func (fsm *Fsm) compensate() (err *FsmError) {
+	run := func(step int, undo []compensation) {
+		for idx := len(undo) - 1; idx >= 0; idx-- {
+			e := fsm.doAction(&fsm.stack, "compensation", undo[idx].name, undo[idx].action)
+			fsm.notifyAction(undo[idx].owner(fsm.structure), nil, "compensation", e)
+			fsm.compensations = append(fsm.compensations, CompensationOutcome{step, undo[idx].name, e})
+			if e != nil && err == nil {
+				err = newFsmErrorCallbackFailed("compensation of "+undo[idx].name, e)
+			}
+		}
+	}
+
+	// unfinished step (if any) is the most recent one
+	run(-1, fsm.undo)
+	fsm.undo = nil
+	for idx := len(fsm.history) - 1; idx >= 0; idx-- {
+		run(idx, fsm.history[idx].undo)
+		fsm.history[idx].undo = nil
+	}
+	fsm.attempts, fsm.actions = nil, nil
+	return
+}
+
+// Compensations
+// Returns outcomes of compensating actions executed so far
+func (fsm *Fsm) Compensations() []CompensationOutcome {
+	return fsm.compensations
+}
@@ -0,0 +1,81 @@
+package simple_fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFsmCompensateOnFatal(t *testing.T) {
+	var log []string
+	fsm := NewFsm(makeSagaStructure(&log, true, false))
+	if _, err := fsm.Run(); err == nil || !fsm.Fatal() {
+		t.Log("FSM should go fatal when an action fails")
+		t.FailNow()
+	}
+
+	expected := []string{"charge", "ship", "refund", "release"}
+	if !reflect.DeepEqual(log, expected) {
+		t.Logf("Compensations should run in reverse order, failed action is not compensated: %v", log)
+		t.FailNow()
+	}
+
+	outcomes := fsm.Compensations()
+	if len(outcomes) != 2 || outcomes[0].Name != "2-3" || outcomes[1].Name != "1" || outcomes[0].Err != nil {
+		t.Logf("Compensation outcomes should be recorded: %v", outcomes)
+		t.FailNow()
+	}
+	if outcomes[0].Step <= outcomes[1].Step {
+		t.Logf("Outcomes should refer to history items: %v", outcomes)
+		t.FailNow()
+	}
+}
+
+func TestFsmCompensateExplicit(t *testing.T) {
+	var log []string
+	fsm := NewFsm(makeSagaStructure(&log, false, false))
+	if err := fsm.Compensate(); err == nil || err.Kind() != ErrFsmWrongFlow {
+		t.Logf("Idle FSM should not compensate: %v", err)
+		t.FailNow()
+	}
+
+	if _, err := fsm.Run(); err != nil && !fsm.Completed() {
+		t.Logf("FSM should complete: %v", err)
+		t.FailNow()
+	}
+	if err := fsm.Compensate(); err != nil {
+		t.Logf("Compensation should succeed: %v", err)
+		t.FailNow()
+	}
+	if err := fsm.Compensate(); err != nil || len(fsm.Compensations()) != 3 {
+		t.Logf("Every compensation should run only once: %v", fsm.Compensations())
+		t.FailNow()
+	}
+
+	expected := []string{"charge", "ship", "unship", "refund", "release"}
+	if !reflect.DeepEqual(log, expected) || !fsm.Completed() {
+		t.Logf("Compensation should undo the whole run and keep FSM status: %v", log)
+		t.FailNow()
+	}
+}
+
+func TestFsmCompensateFailure(t *testing.T) {
+	var log []string
+	fsm := NewFsm(makeSagaStructure(&log, false, true))
+	fsm.Run()
+
+	err := fsm.Compensate()
+	if err == nil || err.Kind() != ErrFsmCallbackFailed {
+		t.Logf("Failed compensation should be reported: %v", err)
+		t.FailNow()
+	}
+
+	expected := []string{"charge", "ship", "unship", "refund", "release"}
+	if !reflect.DeepEqual(log, expected) {
+		t.Logf("Failed compensation should not stop the rest: %v", log)
+		t.FailNow()
+	}
+	if outcomes := fsm.Compensations(); len(outcomes) != 3 || outcomes[1].Err == nil {
+		t.Logf("Failure should be recorded in the outcome: %v", outcomes)
+		t.FailNow()
+	}
+}
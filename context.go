@@ -2,6 +2,7 @@ package simple_fsm
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strings"
 )
@@ -32,6 +33,16 @@ type ContextOperator interface {
 	ContextModifier
 }
 
+// GoContext
+// Extracts go context (cancellation, deadline) of the running FSM step
+// from guard/action argument, returns background context if there's none
+func GoContext(ctx ContextAccessor) context.Context {
+	if carrier, ok := ctx.(interface{ GoContext() context.Context }); ok {
+		return carrier.GoContext()
+	}
+	return context.Background()
+}
+
 // Context
 // Provides associative storage for objects of any type
 // Implements both ContextAccessor and ContextModifier
@@ -0,0 +1,69 @@
+package simple_fsm
+
+// contextWrite
+// Context member written by an action, state is the one owning modified context
+type contextWrite struct {
+	state string
+	key   string
+	value interface{}
+}
+
+// contextRecorder
+// Context operator recording members written to the stack
+type contextRecorder struct {
+	*ContextStack
+	writes []contextWrite
+}
+
+// newContextRecorder
+// Constructs recorder of writes to given stack
+func newContextRecorder(stack *ContextStack) *contextRecorder {
+	return &contextRecorder{ContextStack: stack}
+}
+
+// ContextModifier.Put
+// Adds new / modifies a member of head context, records the write
+func (cr *contextRecorder) Put(key string, value interface{}) *FsmError {
+	if err := cr.ContextStack.Put(key, value); err != nil {
+		return err
+	}
+	cr.writes = append(cr.writes, contextWrite{cr.Peek().state.Name, key, value})
+	return nil
+}
+
+// ContextModifier.PutParent
+// Adds new / modifies a member of parent context, records the write
+func (cr *contextRecorder) PutParent(key string, value interface{}) *FsmError {
+	if err := cr.ContextStack.PutParent(key, value); err != nil {
+		return err
+	}
+	cr.writes = append(cr.writes, contextWrite{cr.Parent().state.Name, key, value})
+	return nil
+}
+
+// ContextModifier.PutResult
+// Sets / modifies result in global context, records the write
+func (cr *contextRecorder) PutResult(result interface{}) *FsmError {
+	if err := cr.ContextStack.PutResult(result); err != nil {
+		return err
+	}
+	cr.writes = append(cr.writes, contextWrite{cr.Global().state.Name, FsmResultCtxMemberName, result})
+	return nil
+}
+
+// applyWrites
+// Repeats recorded writes on given stack, state contexts are looked up by name
+// Writes without a state go to the head context
+func applyWrites(stack *ContextStack, writes []contextWrite) *FsmError {
+	for _, w := range writes {
+		sc := stack.Peek()
+		if w.state != "" {
+			sc = stack.ByState(w.state)
+		}
+		if sc == nil {
+			return newFsmErrorRuntime("written state is not active", w.state)
+		}
+		sc.Put(w.key, w.value)
+	}
+	return nil
+}
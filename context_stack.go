@@ -2,8 +2,10 @@ package simple_fsm
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strings"
+	"time"
 )
 
 //
@@ -11,9 +13,12 @@ import (
 //
 
 // Element of context stack, encapsulates state info and context
+// State with orthogonal regions owns a nested stack per region
 type StateContext struct {
 	state   *StateInfo
 	context Context
+	regions []*ContextStack
+	entered time.Time // when the state was entered, if metrics are enabled
 }
 
 // newStateContext
@@ -22,6 +27,23 @@ func newStateContext(state *StateInfo) StateContext {
 	return StateContext{state: state, context: newContext()}
 }
 
+// completed
+// Checks if state is final and all its regions (if any) are completed
+func (sc *StateContext) completed() bool {
+	return sc.state.Final() && sc.regionsCompleted()
+}
+
+// regionsCompleted
+// Checks if every region of the state has reached a final state
+func (sc *StateContext) regionsCompleted() bool {
+	for _, region := range sc.regions {
+		if !region.completed() {
+			return false
+		}
+	}
+	return true
+}
+
 // ContextModifier.Put
 // Adds new / modifies existing member of underlying context
 func (sc *StateContext) Put(key string, value interface{}) *FsmError {
@@ -48,8 +70,16 @@ func (sc *StateContext) PutResult(result interface{}) *FsmError {
 // defines usual stack operations like pop/push/peek
 // implements ContextAccessor - meaning it can be read exactly like
 // Context (writing is intentionally excluded)
+// While an event is being processed, its payload is available
+// on top of the head context (see setEvent)
+// While FSM makes a step, go context of the step is available via GoContext()
+// Stacks of orthogonal regions are linked to the stack of their parallel state,
+// so active states form a tree; lookups go from region head to the global state
 type ContextStack struct {
-	stack []StateContext
+	stack  []StateContext
+	parent *ContextStack
+	event  *Context
+	goCtx  context.Context
 }
 
 // newContextStack
@@ -58,6 +88,37 @@ func newContextStack() ContextStack {
 	return ContextStack{}
 }
 
+// newRegionStack
+// Constructs context stack for a region of parallel state, which is the head of parent stack
+func newRegionStack(parent *ContextStack) *ContextStack {
+	return &ContextStack{parent: parent}
+}
+
+// root
+// Returns outermost stack in the tree
+func (st *ContextStack) root() *ContextStack {
+	for st.parent != nil {
+		st = st.parent
+	}
+	return st
+}
+
+// GoContext
+// Returns go context of the step being made, background context otherwise
+func (st *ContextStack) GoContext() context.Context {
+	if ctx := st.root().goCtx; ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
+
+// completed
+// Checks if the stack has reached a final state directly under its bottom state
+// (global or region one). Final state nested deeper only completes its parent
+func (st *ContextStack) completed() bool {
+	return st.Depth() == FsmAutoStatesCount+1 && st.Peek().completed()
+}
+
 // Depth
 // Returns number of elements in stack context
 func (st *ContextStack) Depth() int {
@@ -81,7 +142,11 @@ func (st *ContextStack) Peek() *StateContext {
 
 // Parent
 // Returns context previous to head, without modification
+// For region stacks with single element it is parallel state context
 func (st *ContextStack) Parent() *StateContext {
+	if st.Depth() == 1 && st.parent != nil {
+		return st.parent.Peek()
+	}
 	if st.Depth() < 2 {
 		return nil
 	}
@@ -92,6 +157,9 @@ func (st *ContextStack) Parent() *StateContext {
 // Global
 // Returns global (outermost) state context or nil if stack is empty
 func (st *ContextStack) Global() *StateContext {
+	if st.parent != nil {
+		return st.parent.Global()
+	}
 	if st.Empty() {
 		return nil
 	}
@@ -112,6 +180,9 @@ func (st *ContextStack) ByState(name string) *StateContext {
 			return &st.stack[idx]
 		}
 	}
+	if st.parent != nil {
+		return st.parent.ByState(name)
+	}
 	return nil
 }
 
@@ -142,22 +213,46 @@ func (st *ContextStack) Push(state *StateInfo) *StateContext {
 	return st.Peek()
 }
 
+// setEvent
+// Makes event name and payload visible to stack readers
+// until clearEvent is called
+func (st *ContextStack) setEvent(name string, payload map[string]interface{}) {
+	event := newContext()
+	for k, v := range payload {
+		event.Put(k, v)
+	}
+	event.Put(FsmEventCtxMemberName, name)
+	st.event = &event
+}
+
+// clearEvent
+// Discards event context set by setEvent
+func (st *ContextStack) clearEvent() {
+	st.event = nil
+}
+
 // ContextAccessor.Raw
 // Searches for given key in all contexts present in the stack,
 // from head to tail, returns interface{}-boxed value
 // Note: if there are duplicate keys in different contexts,
-// one closest to the head will overshadow others
+// one closest to the head will overshadow others.
+// Payload of the event being processed overshadows all contexts,
+// region stacks continue the search in parent stacks
 func (st *ContextStack) Raw(key string) (value interface{}, err *FsmError) {
-	if st.Empty() {
-		return nil, newCtxErrorKeyNotFound(key)
+	if event := st.root().event; event != nil {
+		if value, err = event.Raw(key); err == nil {
+			return
+		}
 	}
 
-	for idx := len(st.stack) - 1; idx >= 0; idx-- {
-		if value, err = st.stack[idx].context.Raw(key); err == nil {
-			return
+	for curr := st; curr != nil; curr = curr.parent {
+		for idx := len(curr.stack) - 1; idx >= 0; idx-- {
+			if value, err = curr.stack[idx].context.Raw(key); err == nil {
+				return
+			}
 		}
 	}
-	return
+	return nil, newCtxErrorKeyNotFound(key)
 }
 
 // ContextAccessor.Has
@@ -259,8 +354,16 @@ func (st *ContextStack) PutResult(result interface{}) (err *FsmError) {
 // Print out an object in a user-friendly way, composable
 func (st *ContextStack) dump(buf *bytes.Buffer, indent int) {
 	indentStr := strings.Repeat("\t", indent)
+	if st.event != nil {
+		buf.WriteString(fmt.Sprintf("%s> event:\n", indentStr))
+		st.event.dump(buf, indent+1)
+	}
 	for _, elem := range st.stack {
 		buf.WriteString(fmt.Sprintf("%s> state: \"%s\"\n", indentStr, elem.state.Name))
 		elem.context.dump(buf, indent+1)
+		for _, region := range elem.regions {
+			buf.WriteString(fmt.Sprintf("%s\t> region:\n", indentStr))
+			region.dump(buf, indent+2)
+		}
 	}
 }
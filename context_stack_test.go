@@ -182,3 +182,64 @@ func TestStackStr(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestStackEvent(t *testing.T) {
+	cs := newContextStack()
+	cs.Push(&StateInfo{}).Put("key", 42)
+
+	cs.setEvent("go", map[string]interface{}{"key": 7})
+	if value, err := cs.Int("key"); value != 7 || err != nil {
+		t.Log("Event payload should overshadow stack contexts")
+		t.FailNow()
+	}
+	if value, err := cs.Str(FsmEventCtxMemberName); value != "go" || err != nil {
+		t.Log("Event name should be accessible")
+		t.FailNow()
+	}
+
+	cs.clearEvent()
+	if value, err := cs.Int("key"); value != 42 || err != nil {
+		t.Log("Stack contexts should be visible after event is cleared")
+		t.FailNow()
+	}
+	if cs.Has(FsmEventCtxMemberName) {
+		t.Log("Event name should not be accessible after event is cleared")
+		t.FailNow()
+	}
+}
+
+func TestRegionStack(t *testing.T) {
+	cs := newContextStack()
+	cs.Push(&StateInfo{Name: "global"}).Put("key", 42)
+	cs.Push(&StateInfo{Name: "parallel"}).Put("parallel", true)
+
+	region := newRegionStack(&cs)
+	region.Push(&StateInfo{Name: "region"}).Put("key", 7)
+
+	if region.Global() != cs.Global() {
+		t.Log("Region stack should share global context with the root")
+		t.FailNow()
+	}
+	if region.Parent() != cs.Peek() {
+		t.Log("Parallel state should be a parent of the region")
+		t.FailNow()
+	}
+	if value, err := region.Int("key"); value != 7 || err != nil {
+		t.Log("Region context should overshadow outer ones")
+		t.FailNow()
+	}
+	if value, err := region.Bool("parallel"); !value || err != nil {
+		t.Log("Outer contexts should be visible from the region")
+		t.FailNow()
+	}
+	if region.ByState("global") == nil {
+		t.Log("Outer states should be found from the region")
+		t.FailNow()
+	}
+
+	cs.setEvent("go", nil)
+	if value, err := region.Str(FsmEventCtxMemberName); value != "go" || err != nil {
+		t.Log("Event should be visible from the region")
+		t.FailNow()
+	}
+}
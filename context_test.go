@@ -1,6 +1,7 @@
 package simple_fsm
 
 import (
+	"context"
 	"testing"
 )
 
@@ -136,3 +137,19 @@ func TestStrMissing(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestGoContext(t *testing.T) {
+	ctx := newContext()
+	if GoContext(&ctx) != context.Background() {
+		t.Log("Plain context should not carry go context")
+		t.FailNow()
+	}
+
+	type key struct{}
+	cs := newContextStack()
+	cs.goCtx = context.WithValue(context.Background(), key{}, 42)
+	if GoContext(&cs).Value(key{}) != 42 {
+		t.Log("Context stack should carry go context of the step")
+		t.FailNow()
+	}
+}
@@ -3,6 +3,7 @@ package simple_fsm
 import (
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 // FsmErrorKind
@@ -20,13 +21,63 @@ const (
 	ErrFsmRuntime
 	ErrFsmCallbackFailed
 	ErrFsmInFatalState
+	ErrFsmAwaitingEvent
+	ErrFsmEventUnhandled
+	ErrFsmConflict
+	ErrFsmInfiniteLoop
+	ErrFsmCancelled
+	ErrFsmSnapshot
+	ErrStoreNotFound
+	ErrStoreVersionMismatch
+	ErrStoreFailed
+	ErrFsmInDoubt
+	ErrFsmDiverged
+	ErrFsmInvalidArgument
 )
 
+// fsmErrorKindNames
+// Names of error kinds, indexed by kind
+var fsmErrorKindNames = []string{
+	"ErrCtxKeyNotFound",
+	"ErrCtxInvalidType",
+	"ErrStateAlreadyExists",
+	"ErrStateIsInvalid",
+	"ErrFsmLoading",
+	"ErrFsmWrongFlow",
+	"ErrFsmIsInvalid",
+	"ErrFsmRuntime",
+	"ErrFsmCallbackFailed",
+	"ErrFsmInFatalState",
+	"ErrFsmAwaitingEvent",
+	"ErrFsmEventUnhandled",
+	"ErrFsmConflict",
+	"ErrFsmInfiniteLoop",
+	"ErrFsmCancelled",
+	"ErrFsmSnapshot",
+	"ErrStoreNotFound",
+	"ErrStoreVersionMismatch",
+	"ErrStoreFailed",
+	"ErrFsmInDoubt",
+	"ErrFsmDiverged",
+	"ErrFsmInvalidArgument",
+}
+
+// String
+// Returns error kind name, as it is declared
+func (k FsmErrorKind) String() string {
+	if k < 0 || int(k) >= len(fsmErrorKindNames) {
+		return fmt.Sprintf("FsmErrorKind(%d)", int(k))
+	}
+	return fsmErrorKindNames[k]
+}
+
 // FsmError
 // Type containing information about internal FSM error
+// Underlying error (if any) is available via errors.Unwrap()
 type FsmError struct {
 	kind        FsmErrorKind
 	description string
+	cause       error
 }
 
 // Kind
@@ -35,6 +86,12 @@ func (e *FsmError) Kind() FsmErrorKind {
 	return e.kind
 }
 
+// Unwrap
+// Returns underlying error, if there's one
+func (e *FsmError) Unwrap() error {
+	return e.cause
+}
+
 // Error
 // Implementation fo standard error interface
 // Returns a string with combined error description
@@ -60,6 +117,30 @@ func (e *FsmError) Error() string {
 		return fmt.Sprintf("User-defined callback returned an error: %s", e.description)
 	case ErrFsmInFatalState:
 		return fmt.Sprintf("FSM stopped due to fatal error: %s", e.description)
+	case ErrFsmAwaitingEvent:
+		return fmt.Sprintf("FSM can't proceed without an event: %s", e.description)
+	case ErrFsmEventUnhandled:
+		return fmt.Sprintf("Event was not handled: %s", e.description)
+	case ErrFsmConflict:
+		return fmt.Sprintf("Can't choose between opened transitions: %s", e.description)
+	case ErrFsmInfiniteLoop:
+		return fmt.Sprintf("FSM is stuck in a loop: %s", e.description)
+	case ErrFsmCancelled:
+		return fmt.Sprintf("FSM execution was interrupted: %s", e.description)
+	case ErrFsmSnapshot:
+		return fmt.Sprintf("FSM snapshot can't be taken or restored: %s", e.description)
+	case ErrStoreNotFound:
+		return fmt.Sprintf("No such FSM instance in the store: \"%s\"", e.description)
+	case ErrStoreVersionMismatch:
+		return fmt.Sprintf("FSM instance was modified concurrently: %s", e.description)
+	case ErrStoreFailed:
+		return fmt.Sprintf("FSM store operation failed: %s", e.description)
+	case ErrFsmInDoubt:
+		return fmt.Sprintf("FSM can't proceed until in-doubt actions are resolved: %s", e.description)
+	case ErrFsmDiverged:
+		return fmt.Sprintf("Replay diverged from recording: %s", e.description)
+	case ErrFsmInvalidArgument:
+		return fmt.Sprintf("Invalid argument: %s", e.description)
 	default:
 		return "Unknown error"
 	}
@@ -145,6 +226,127 @@ func newFsmErrorCallbackFailed(who string, e error) *FsmError {
 	return &FsmError{
 		kind:        ErrFsmCallbackFailed,
 		description: fmt.Sprintf("%s, \"%s\"", who, e.Error()),
+		cause:       e,
+	}
+}
+
+// newFsmErrorAwaitingEvent
+// Constructs "no unconditional way out of the state, event is needed" error
+func newFsmErrorAwaitingEvent(state string) *FsmError {
+	return &FsmError{
+		kind:        ErrFsmAwaitingEvent,
+		description: fmt.Sprintf("state \"%s\" only has closed or event transitions", state),
+	}
+}
+
+// newFsmErrorEventUnhandled
+// Constructs "fired event doesn't open any transition" error
+func newFsmErrorEventUnhandled(event string, state string) *FsmError {
+	return &FsmError{
+		kind:        ErrFsmEventUnhandled,
+		description: fmt.Sprintf("no open transitions for \"%s\" in state \"%s\"", event, state),
+	}
+}
+
+// newFsmErrorConflict
+// Constructs "several transitions are opened at once" error
+func newFsmErrorConflict(state string, transitions []string) *FsmError {
+	return &FsmError{
+		kind:        ErrFsmConflict,
+		description: fmt.Sprintf("state \"%s\", transitions \"%s\"", state, strings.Join(transitions, "\", \"")),
+	}
+}
+
+// newFsmErrorInfiniteLoop
+// Constructs "FSM is stuck in transition loop" error
+func newFsmErrorInfiniteLoop(cause string, cycle []string) *FsmError {
+	return &FsmError{
+		kind:        ErrFsmInfiniteLoop,
+		description: fmt.Sprintf("%s, cycle: %s", cause, strings.Join(cycle, " -> ")),
+	}
+}
+
+// newFsmErrorStepLimit
+// Constructs "FSM step budget is exceeded" error, trail holds the states leading to the offending step
+func newFsmErrorStepLimit(cause string, trail []string) *FsmError {
+	return &FsmError{
+		kind:        ErrFsmInfiniteLoop,
+		description: fmt.Sprintf("%s, trail: %s", cause, strings.Join(trail, " -> ")),
+	}
+}
+
+// newFsmErrorCancelled
+// Constructs "FSM step was interrupted by go context" error
+func newFsmErrorCancelled(e error) *FsmError {
+	return &FsmError{
+		kind:        ErrFsmCancelled,
+		description: e.Error(),
+		cause:       e,
+	}
+}
+
+// newFsmErrorSnapshot
+// Constructs "FSM can't be saved to / restored from a snapshot" error
+func newFsmErrorSnapshot(cause string) *FsmError {
+	return &FsmError{
+		kind:        ErrFsmSnapshot,
+		description: cause,
+	}
+}
+
+// newStoreErrorNotFound
+// Constructs "instance is not present in the store" error
+func newStoreErrorNotFound(id string) *FsmError {
+	return &FsmError{kind: ErrStoreNotFound, description: id}
+}
+
+// newStoreErrorVersionMismatch
+// Constructs "stored instance version is different from expected" error
+func newStoreErrorVersionMismatch(id string, expected int, actual int) *FsmError {
+	return &FsmError{
+		kind:        ErrStoreVersionMismatch,
+		description: fmt.Sprintf("instance \"%s\", expected version %d, actual %d", id, expected, actual),
+	}
+}
+
+// newStoreErrorFailed
+// Constructs "store can't read/write an instance" error
+func newStoreErrorFailed(id string, e error) *FsmError {
+	return &FsmError{
+		kind:        ErrStoreFailed,
+		description: fmt.Sprintf("instance \"%s\", \"%s\"", id, e.Error()),
+		cause:       e,
+	}
+}
+
+// newFsmErrorInDoubt
+// Constructs "outcome of journaled actions is unknown" error
+func newFsmErrorInDoubt(records []JournalRecord) *FsmError {
+	actions := make([]string, 0, len(records))
+	for _, rec := range records {
+		actions = append(actions, fmt.Sprintf("#%d \"%s\" of state \"%s\"", rec.Seq, rec.Transition, rec.State))
+	}
+	return &FsmError{
+		kind:        ErrFsmInDoubt,
+		description: strings.Join(actions, ", "),
+	}
+}
+
+// newFsmErrorDiverged
+// Constructs "replayed run is different from recorded one" error
+func newFsmErrorDiverged(call int, step int, expected string, actual string) *FsmError {
+	return &FsmError{
+		kind:        ErrFsmDiverged,
+		description: fmt.Sprintf("call #%d, step #%d: expected %s, got %s", call, step, expected, actual),
+	}
+}
+
+// newFsmErrorInvalidArgument
+// Constructs "API call argument is not valid" error
+func newFsmErrorInvalidArgument(name string, cause string) *FsmError {
+	return &FsmError{
+		kind:        ErrFsmInvalidArgument,
+		description: fmt.Sprintf("%s %s", name, cause),
 	}
 }
 
@@ -0,0 +1,115 @@
+package simple_fsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+const (
+	FileJournalExtension = ".journal"
+)
+
+// FileJournal
+// Journal keeping records of every instance in a separate file of a local directory,
+// one JSON record per line. Every record is flushed to disk before Append returns.
+// Record torn by a crash (the last line only) is ignored
+type FileJournal struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileJournal
+// Constructs a journal using given directory, creates it if it doesn't exist
+func NewFileJournal(dir string) (*FileJournal, *FsmError) {
+	if e := os.MkdirAll(dir, 0o755); e != nil {
+		return nil, newStoreErrorFailed(dir, e)
+	}
+	return &FileJournal{dir: dir}, nil
+}
+
+// Journal.Append
+func (fj *FileJournal) Append(id string, record JournalRecord) *FsmError {
+	path, err := instanceFile(fj.dir, id, FileJournalExtension)
+	if err != nil {
+		return err
+	}
+	raw, e := json.Marshal(record)
+	if e != nil {
+		return newStoreErrorFailed(id, e)
+	}
+
+	fj.mu.Lock()
+	defer fj.mu.Unlock()
+
+	file, e := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if e != nil {
+		return newStoreErrorFailed(id, e)
+	}
+	if _, e = file.Write(append(raw, '\n')); e == nil {
+		e = file.Sync()
+	}
+	if ce := file.Close(); e == nil {
+		e = ce
+	}
+	if e != nil {
+		return newStoreErrorFailed(id, e)
+	}
+	return nil
+}
+
+// Journal.Records
+func (fj *FileJournal) Records(id string) (records []JournalRecord, err *FsmError) {
+	path, err := instanceFile(fj.dir, id, FileJournalExtension)
+	if err != nil {
+		return
+	}
+
+	fj.mu.Lock()
+	raw, e := os.ReadFile(path)
+	fj.mu.Unlock()
+
+	switch {
+	case errors.Is(e, fs.ErrNotExist):
+		return
+	case e != nil:
+		err = newStoreErrorFailed(id, e)
+		return
+	}
+
+	lines := bytes.Split(raw, []byte("\n"))
+	for idx, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		var rec JournalRecord
+		if e = json.Unmarshal(line, &rec); e != nil {
+			if idx == len(lines)-1 {
+				// torn last record, it was never complete
+				break
+			}
+			err = newStoreErrorFailed(id, e)
+			return
+		}
+		records = append(records, rec)
+	}
+	return
+}
+
+// Journal.Truncate
+func (fj *FileJournal) Truncate(id string) *FsmError {
+	path, err := instanceFile(fj.dir, id, FileJournalExtension)
+	if err != nil {
+		return err
+	}
+
+	fj.mu.Lock()
+	defer fj.mu.Unlock()
+	if e := os.Remove(path); e != nil && !errors.Is(e, fs.ErrNotExist) {
+		return newStoreErrorFailed(id, e)
+	}
+	return nil
+}
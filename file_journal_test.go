@@ -0,0 +1,55 @@
+package simple_fsm
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFileJournal(t *testing.T) {
+	journal, err := NewFileJournal(t.TempDir())
+	if err != nil {
+		t.Logf("Journal should be created: %v", err)
+		t.FailNow()
+	}
+	if records, err := journal.Records("a"); err != nil || len(records) != 0 {
+		t.Logf("Missing journal should be empty: %v", err)
+		t.FailNow()
+	}
+
+	journal.Append("a", JournalRecord{Seq: 1, Kind: JournalIntent, Step: 3})
+	journal.Append("a", JournalRecord{Seq: 1, Kind: JournalCommit, Step: 3, Writes: []JournalWrite{
+		{Key: "k", Value: SnapshotValue{Type: "int", Value: []byte("1")}},
+	}})
+	records, err := journal.Records("a")
+	if err != nil || len(records) != 2 || records[1].Kind != JournalCommit || len(records[1].Writes) != 1 {
+		t.Logf("Records should be read in order: %v, %v", records, err)
+		t.FailNow()
+	}
+
+	// record torn by a crash
+	path, _ := instanceFile(journal.dir, "a", FileJournalExtension)
+	appendRaw(t, path, `{"seq": 2, "ki`)
+	if records, err = journal.Records("a"); err != nil || len(records) != 2 {
+		t.Logf("Torn record should be ignored: %v, %v", records, err)
+		t.FailNow()
+	}
+
+	if err = journal.Truncate("a"); err != nil {
+		t.Logf("Journal should be truncated: %v", err)
+		t.FailNow()
+	}
+	if records, _ = journal.Records("a"); len(records) != 0 {
+		t.Logf("Truncated journal should be empty: %v", records)
+		t.FailNow()
+	}
+}
+
+func appendRaw(t *testing.T, path string, raw string) {
+	file, e := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if e != nil {
+		t.Logf("Journal file should exist: %v", e)
+		t.FailNow()
+	}
+	file.WriteString(raw)
+	file.Close()
+}
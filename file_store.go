@@ -0,0 +1,190 @@
+package simple_fsm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	FileStoreExtension = ".json"
+)
+
+// FileStore
+// Store keeping every instance in a separate JSON file of a local directory
+// Files are replaced atomically (written to a temporary file, then renamed),
+// so crash never leaves a partially written instance behind
+// Version checks are serialized within the process only, the directory
+// should not be shared by several processes writing the same instances
+type FileStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewFileStore
+// Constructs a store using given directory, creates it if it doesn't exist
+func NewFileStore(dir string) (*FileStore, *FsmError) {
+	if e := os.MkdirAll(dir, 0o755); e != nil {
+		return nil, newStoreErrorFailed(dir, e)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// instanceFile
+// Returns path of instance file in given directory
+// Instance ID should be a plain file name, hidden files are reserved for temporary ones
+func instanceFile(dir string, id string, ext string) (string, *FsmError) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", newStoreErrorFailed(id, fmt.Errorf("instance ID should be a plain file name"))
+	}
+	return filepath.Join(dir, id+ext), nil
+}
+
+// path
+// Returns instance file path
+func (fst *FileStore) path(id string) (string, *FsmError) {
+	return instanceFile(fst.dir, id, FileStoreExtension)
+}
+
+// read
+// Reads stored instance, missing file means version 0
+func (fst *FileStore) read(id string) (instance storedInstance, present bool, err *FsmError) {
+	path, err := fst.path(id)
+	if err != nil {
+		return
+	}
+	raw, e := os.ReadFile(path)
+	switch {
+	case errors.Is(e, fs.ErrNotExist):
+		return
+	case e != nil:
+		err = newStoreErrorFailed(id, e)
+		return
+	}
+	if e = json.Unmarshal(raw, &instance); e != nil {
+		err = newStoreErrorFailed(id, e)
+		return
+	}
+	present = true
+	return
+}
+
+// write
+// Atomically replaces instance file
+func (fst *FileStore) write(id string, instance storedInstance) *FsmError {
+	path, err := fst.path(id)
+	if err != nil {
+		return err
+	}
+	raw, e := json.Marshal(instance)
+	if e != nil {
+		return newStoreErrorFailed(id, e)
+	}
+
+	tmp, e := os.CreateTemp(fst.dir, "."+id+".*")
+	if e != nil {
+		return newStoreErrorFailed(id, e)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, e = tmp.Write(raw); e == nil {
+		e = tmp.Sync()
+	}
+	if ce := tmp.Close(); e == nil {
+		e = ce
+	}
+	if e == nil {
+		e = os.Rename(tmp.Name(), path)
+	}
+	if e != nil {
+		return newStoreErrorFailed(id, e)
+	}
+	return nil
+}
+
+// Store.Save
+func (fst *FileStore) Save(id string, snapshot *Snapshot, expected int) (version int, err *FsmError) {
+	raw, e := json.Marshal(snapshot)
+	if e != nil {
+		return 0, newStoreErrorFailed(id, e)
+	}
+
+	fst.mu.Lock()
+	defer fst.mu.Unlock()
+
+	current, _, err := fst.read(id)
+	if err != nil {
+		return
+	}
+	if current.Version != expected {
+		return 0, newStoreErrorVersionMismatch(id, expected, current.Version)
+	}
+	version = expected + 1
+	if err = fst.write(id, storedInstance{Version: version, Snapshot: raw}); err != nil {
+		version = 0
+	}
+	return
+}
+
+// Store.Load
+func (fst *FileStore) Load(id string) (snapshot *Snapshot, version int, err *FsmError) {
+	fst.mu.Lock()
+	instance, present, err := fst.read(id)
+	fst.mu.Unlock()
+
+	switch {
+	case err != nil:
+		return
+	case !present:
+		err = newStoreErrorNotFound(id)
+		return
+	}
+	return instance.decode(id)
+}
+
+// Store.Delete
+func (fst *FileStore) Delete(id string, expected int) *FsmError {
+	fst.mu.Lock()
+	defer fst.mu.Unlock()
+
+	instance, present, err := fst.read(id)
+	switch {
+	case err != nil:
+		return err
+	case !present:
+		return newStoreErrorNotFound(id)
+	case instance.Version != expected:
+		return newStoreErrorVersionMismatch(id, expected, instance.Version)
+	}
+
+	path, _ := fst.path(id)
+	if e := os.Remove(path); e != nil {
+		return newStoreErrorFailed(id, e)
+	}
+	return nil
+}
+
+// Store.List
+func (fst *FileStore) List() ([]string, *FsmError) {
+	entries, e := os.ReadDir(fst.dir)
+	if e != nil {
+		return nil, newStoreErrorFailed(fst.dir, e)
+	}
+
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, FileStoreExtension) {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, FileStoreExtension))
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,54 @@
+package simple_fsm
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Logf("Store should be created: %v", err)
+		t.FailNow()
+	}
+	testStoreContract(t, store)
+
+	entries, _ := os.ReadDir(store.dir)
+	if len(entries) != 1 || entries[0].Name() != "b"+FileStoreExtension {
+		t.Logf("Only instance files should be left in the directory: %v", entries)
+		t.FailNow()
+	}
+
+	for _, id := range []string{"", "..", "../a", "a/b", ".hidden"} {
+		if _, err := store.Save(id, &Snapshot{}, 0); err == nil || err.Kind() != ErrStoreFailed {
+			t.Logf("Instance ID \"%s\" should be rejected", id)
+			t.FailNow()
+		}
+	}
+}
+
+func TestFileStoreRestart(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewFileStore(dir)
+	fsm := NewFsm(makeApprovalStructure(), WithStore(store, "req-1"))
+	fsm.Run()
+
+	// temporary files of interrupted writes are ignored
+	os.WriteFile(dir+"/.req-2.123", []byte("{"), 0o644)
+
+	store, _ = NewFileStore(dir)
+	if ids, _ := store.List(); len(ids) != 1 || ids[0] != "req-1" {
+		t.Logf("Stored instance should be found after restart: %v", ids)
+		t.FailNow()
+	}
+	loaded, err := LoadFsm(store, "req-1", makeApprovalStructure())
+	if err != nil {
+		t.Logf("Stored instance should be loaded after restart: %v", err)
+		t.FailNow()
+	}
+	if loaded.Fire("approve", nil); !loaded.Completed() {
+		t.Log("Loaded FSM should complete")
+		t.Log(Dump(loaded))
+		t.FailNow()
+	}
+}
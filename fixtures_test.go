@@ -0,0 +1,326 @@
+package simple_fsm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeClock
+// Clock which doesn't wait, it only records requested delays
+type fakeClock struct {
+	now    time.Time
+	delays []time.Duration
+}
+
+func (fc *fakeClock) Now() time.Time {
+	return fc.now
+}
+
+func (fc *fakeClock) After(d time.Duration) <-chan time.Time {
+	fc.delays = append(fc.delays, d)
+	fc.now = fc.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- fc.now
+	return ch
+}
+
+// makeRetryStructure
+// "1" -> "2", transition action fails given number of times with errors of given class
+// and busy ones are retried, 3 attempts at most with exponential backoff
+func makeRetryStructure(failures int, class string) *Structure {
+	attempt := 0
+	flaky := NewAction(func(ctx ContextOperator) error {
+		if attempt++; attempt <= failures {
+			return Classify(class, errors.New("service is busy"))
+		}
+		return nil
+	}).WithRetry(RetryPolicy{MaxAttempts: 3, Backoff: BackoffExponential, Delay: 10 * time.Millisecond, On: []string{"busy"}})
+
+	return MakeStructure(nil,
+		NewState("1", NewTransitionAlways("1-2", "2", flaky)),
+		NewState("2", nil),
+	)
+}
+
+// makeSagaStructure
+// 1 (reserve) -> 2 (charge) -> 3 (ship), shipping fails if requested
+func makeSagaStructure(log *[]string, shipFails bool, refundFails bool) *Structure {
+	record := func(name string, fail bool) *PackagedAction {
+		return NewAction(func(ctx ContextOperator) error {
+			*log = append(*log, name)
+			if fail {
+				return errors.New(name + " failed")
+			}
+			return nil
+		})
+	}
+
+	reserved := NewState("1", NewTransitionAlways("1-2", "2", nil)).
+		WithCompensation(record("release", false))
+	charge := NewTransition("2-3", "3", guardAlways, record("charge", false)).
+		WithCompensation(record("refund", refundFails))
+	ship := NewTransition("3-4", "4", guardAlways, record("ship", shipFails)).
+		WithCompensation(record("unship", false))
+
+	return MakeStructure(nil,
+		reserved,
+		NewState("2", []Transition{charge}),
+		NewState("3", []Transition{ship}),
+		NewState("4", nil),
+	)
+}
+
+// roundTrip
+// Takes FSM snapshot, passes it through JSON and restores FSM from it
+func roundTrip(t *testing.T, fsm *Fsm, options ...FsmOption) *Fsm {
+	snapshot, err := fsm.Snapshot()
+	if err != nil {
+		t.Logf("Snapshot() failed: %v", err)
+		t.FailNow()
+	}
+	raw, e := json.Marshal(snapshot)
+	if e != nil {
+		t.Logf("Snapshot should be serializable: %v", e)
+		t.FailNow()
+	}
+	var decoded Snapshot
+	if e = json.Unmarshal(raw, &decoded); e != nil {
+		t.Logf("Snapshot should be deserializable: %v", e)
+		t.FailNow()
+	}
+	restored, err := RestoreFsm(fsm.structure, &decoded, options...)
+	if err != nil {
+		t.Logf("RestoreFsm() failed: %v, snapshot: %s", err, raw)
+		t.FailNow()
+	}
+	return restored
+}
+
+func mustSnapshot(t *testing.T, fsm *Fsm) *Snapshot {
+	snapshot, err := fsm.Snapshot()
+	if err != nil {
+		t.Logf("Snapshot() failed: %v", err)
+		t.FailNow()
+	}
+	return snapshot
+}
+
+// makeApprovalStructure
+// "review" waits for "approve" event, then workflow is done
+func makeApprovalStructure() *Structure {
+	return MakeStructure(nil,
+		NewState("review", []Transition{
+			NewEventTransition("review-approved", "approve", "approved", nil, NewAction(func(ctx ContextOperator) error {
+				ctx.PutResult("approved")
+				return nil
+			})),
+		}),
+		NewState("approved", nil),
+	)
+}
+
+// makeOrderStructure
+// "new" -> "charged" (charges the card) -> "shipped"
+func makeOrderStructure(charges *int) *Structure {
+	charge := NewAction(func(ctx ContextOperator) error {
+		*charges++
+		ctx.Put("receipt", *charges)
+		return nil
+	})
+	return MakeStructure(nil,
+		NewState("new", NewTransitionAlways("new-charged", "charged", charge)),
+		NewState("charged", NewTransitionAlways("charged-shipped", "shipped", nil)),
+		NewState("shipped", nil),
+	)
+}
+
+// makeChoiceOrderStructure
+// "new" -> choice (charges the card on the way) -> "charged" -> "shipped"
+func makeChoiceOrderStructure(charges *int) *Structure {
+	charge := NewAction(func(ctx ContextOperator) error {
+		*charges++
+		ctx.PutResult(*charges)
+		return nil
+	})
+	return MakeStructure(nil,
+		NewState("new", NewTransitionAlways("new-choice", "choice", charge)),
+		NewChoice("choice", []Transition{NewElseTransition("choice-charged", "charged", nil)}),
+		NewState("charged", NewTransitionAlways("charged-shipped", "shipped", nil)),
+		NewState("shipped", nil),
+	)
+}
+
+// makeReplayStructure
+// "start" -> "check" (flaky action) -> "big"/"small" depending on "amount" input,
+// "big" needs an "approve" event, approver becomes the result
+// Callbacks of non-live structure fail, as they're not expected to be called
+func makeReplayStructure(live bool) *Structure {
+	called := errors.New("callback should not be called")
+	failures := 1
+	flaky := NewAction(func(ctx ContextOperator) error {
+		if !live {
+			return called
+		}
+		if failures--; failures >= 0 {
+			return Classify("busy", errors.New("service is busy"))
+		}
+		ctx.Put("checked", time.Duration(42))
+		return nil
+	}).WithRetry(RetryPolicy{MaxAttempts: 2, Delay: time.Hour, On: []string{"busy"}})
+
+	amount := func(big bool) GuardFn {
+		return func(ctx ContextAccessor) (bool, error) {
+			if !live {
+				return false, called
+			}
+			value, err := ctx.Int("amount")
+			if err != nil {
+				return false, err
+			}
+			return (value > 100) == big, nil
+		}
+	}
+	approve := NewAction(func(ctx ContextOperator) error {
+		if !live {
+			return called
+		}
+		by, _ := ctx.Str("by")
+		ctx.PutResult("approved by " + by)
+		return nil
+	})
+
+	return MakeStructure(nil,
+		NewState("start", NewTransitionAlways("start-check", "check", flaky)),
+		NewState("check", []Transition{
+			NewTransition("check-big", "big", amount(true), nil),
+			NewTransition("check-small", "small", amount(false), nil),
+		}),
+		NewState("big", []Transition{NewEventTransition("big-done", "approve", "done", nil, approve)}),
+		NewState("small", NewTransitionAlways("small-done", "done", nil)),
+		NewState("done", nil),
+	)
+}
+
+// tickingClock
+// Clock moving forward by fixed amount every time it's asked for time
+type tickingClock struct {
+	fakeClock
+	tick time.Duration
+}
+
+func (tc *tickingClock) Now() time.Time {
+	tc.now = tc.now.Add(tc.tick)
+	return tc.now
+}
+
+// traceListener
+// Collects lifecycle events as strings
+type traceListener struct {
+	NopListener
+	events []string
+}
+
+func (tl *traceListener) OnGuardEvaluated(step int, state *StateInfo, tr *Transition, open bool, err error) {
+	tl.events = append(tl.events, fmt.Sprintf("%d guard %s/%s %v", step, state.Name, tr.Name, open))
+}
+
+func (tl *traceListener) OnTransitionStart(step int, state *StateInfo, tr *Transition) {
+	tl.events = append(tl.events, fmt.Sprintf("%d start %s/%s", step, state.Name, tr.Name))
+}
+
+func (tl *traceListener) OnStateExit(step int, state *StateInfo) {
+	tl.events = append(tl.events, fmt.Sprintf("%d exit %s", step, state.Name))
+}
+
+func (tl *traceListener) OnStateEnter(step int, state *StateInfo) {
+	tl.events = append(tl.events, fmt.Sprintf("%d enter %s", step, state.Name))
+}
+
+func (tl *traceListener) OnActionDone(step int, state *StateInfo, tr *Transition, who string, err error) {
+	name := state.Name
+	if tr != nil {
+		name += "/" + tr.Name
+	}
+	tl.events = append(tl.events, fmt.Sprintf("%d %s %s %v", step, who, name, err))
+}
+
+func (tl *traceListener) OnCompleted(step int, result interface{}) {
+	tl.events = append(tl.events, fmt.Sprintf("%d completed %v", step, result))
+}
+
+func (tl *traceListener) OnFatal(step int, err *FsmError) {
+	tl.events = append(tl.events, fmt.Sprintf("%d fatal", step))
+}
+
+// makeListenerStructure
+// "1" (with entry action) -> "2", transition action puts 42 as result or fails if requested
+func makeListenerStructure(fail bool) *Structure {
+	done := NewAction(func(ctx ContextOperator) error {
+		if fail {
+			return errors.New("boom")
+		}
+		ctx.PutResult(42)
+		return nil
+	})
+	return MakeStructure(nil,
+		NewState("1", NewTransitionAlways("1-2", "2", done)).Entry(NewAction(func(ContextOperator) error { return nil })),
+		NewState("2", nil),
+	)
+}
+
+// makeTracedStructure
+// Two-step FSM, transition action has a parameter and starts its own span
+func makeTracedStructure(tracer Tracer, fail bool) *Structure {
+	charge := NewAction(func(ctx ContextOperator) error {
+		_, span := tracer.Start(GoContext(ctx), "payment")
+		span.End()
+		if fail {
+			return errors.New("declined")
+		}
+		ctx.PutResult("charged")
+		return nil
+	}).Param("amount", 42)
+	return MakeStructure(nil,
+		NewState("new", NewTransitionAlways("new-paid", "paid", charge)),
+		NewState("paid", nil),
+	)
+}
+
+// makeCheckoutStructure
+// "cart" -> "paid" if there're items in the cart, charge action writes a receipt
+// and fails if told to, "paid" entry action counts visits and sets the result
+func makeCheckoutStructure(declined bool) *Structure {
+	hasItems := func(ctx ContextAccessor) (bool, error) {
+		items, _ := ctx.Int("items")
+		return items > 0, nil
+	}
+	isEmpty := func(ctx ContextAccessor) (bool, error) {
+		items, _ := ctx.Int("items")
+		return items == 0, nil
+	}
+	charge := NewAction(func(ctx ContextOperator) error {
+		if declined {
+			return errors.New("declined")
+		}
+		currency, _ := ctx.Str("currency")
+		ctx.PutParent("receipt", "42 "+currency)
+		ctx.PutParent("receipt", "43 "+currency)
+		return nil
+	}).Param("currency", "EUR")
+
+	return MakeStructure(nil,
+		NewState("cart", []Transition{
+			NewTransition("cart-empty", "empty", isEmpty, nil),
+			NewTransition("cart-paid", "paid", hasItems, charge),
+		}),
+		NewState("empty", nil),
+		NewState("paid", nil).Entry(NewAction(func(ctx ContextOperator) error {
+			ctx.Put("visits", 1)
+			ctx.PutResult("paid")
+			return nil
+		})),
+	)
+}
@@ -1,18 +1,25 @@
 // Simple finite state machine implementation
-// Supports nested states, state entry and transition actions,
-// uses multi-level contexts for nested states.
+// Supports nested states, orthogonal regions, state entry/exit and transition actions,
+// history and choice/junction pseudo-states, error transitions,
+// named events, uses multi-level contexts for nested states.
 // Normal operation flow:
 // * TBD
 package simple_fsm
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"log/slog"
+	"sort"
+	"time"
 )
 
 const (
 	FsmGlobalStateName        = "global"
 	FsmResultCtxMemberName    = "result"
+	FsmEventCtxMemberName     = "event"
+	FsmErrorCtxMemberName     = "error"
 	FsmDefaultHistoryCapacity = 10
 	FsmAutoStatesCount        = 1
 )
@@ -21,20 +28,61 @@ const (
 // Describes finite state machine
 // Contains state meta info, machine entry point and associated data (contexts)
 type Fsm struct {
-	structure *Structure
-	stack     ContextStack
-	history   History
-	fatal     *FsmError
+	structure  *Structure
+	stack      ContextStack
+	history    History
+	fatal      *FsmError
+	policy     ConflictPolicy
+	precedence TransitionPrecedence
+	failedIn   *StateInfo
+	clock      Clock
+	attempts   []actionAttempt
+
+	// outcomes of callbacks made for the history item being made and its start time
+	guards  []GuardOutcome
+	actions []ActionOutcome
+	started time.Time
+
+	// compensating actions of the current step and outcomes of executed ones
+	undo          []compensation
+	compensations []CompensationOutcome
+	loops         loopGuard
+	memory        map[string]stateMemory
+	codecs        *ValueCodecs
+	persistence   *storeBinding
+
+	// journaled actions to be replayed and the ones with unknown outcome (see RecoverFsm)
+	journal *journalBinding
+	replay  map[journalKey][]contextWrite
+	inDoubt []JournalRecord
+
+	// run being recorded or replayed (see WithRecording, Replay)
+	recording *Recording
+	replaying *replayCursor
+
+	listeners []Listener
+	stepIdx   int
+	logger    *slog.Logger
+	tracer    Tracer
 }
 
 // NewFsm
 // Constructs new state machine, initializes auto states and structures
-func NewFsm(structure *Structure) *Fsm {
+// Options are applied in given order
+func NewFsm(structure *Structure, options ...FsmOption) *Fsm {
 	fsm := Fsm{
 		structure: structure,
 		stack:     newContextStack(),
 		history:   make([]HistoryItem, 0, FsmDefaultHistoryCapacity),
 		fatal:     nil,
+		policy:    ConflictStrict,
+		loops:     newLoopGuard(FsmLimits{}),
+		memory:    make(map[string]stateMemory),
+		clock:     systemClock{},
+		codecs:    builtinCodecs,
+	}
+	for _, option := range options {
+		option(&fsm)
 	}
 	fsm.initStackAutoStates()
 
@@ -45,10 +93,18 @@ func NewFsm(structure *Structure) *Fsm {
 // Resets FSM to state, ready for execution (initial)
 // Progress/results from previous run is discarded
 func (fsm *Fsm) Reset() {
+	fsm.recordCall(RecordedReset, "", nil)(nil)
 	fsm.stack = newContextStack()
 	fsm.initStackAutoStates()
 	fsm.history = make([]HistoryItem, 0, FsmDefaultHistoryCapacity)
 	fsm.fatal = nil
+	fsm.failedIn = nil
+	fsm.undo = nil
+	fsm.compensations = nil
+	fsm.replay = nil
+	fsm.inDoubt = nil
+	fsm.loops.reset()
+	fsm.memory = make(map[string]stateMemory)
 }
 
 // SetInput
@@ -58,6 +114,7 @@ func (fsm *Fsm) SetInput(key string, value interface{}) *FsmError {
 	if !fsm.Idle() {
 		return newFsmErrorWrongFlow("set input parameter", "not idle")
 	}
+	fsm.recordCall(RecordedInput, "", map[string]interface{}{key: value})(nil)
 	fsm.stack.Global().Put(key, value)
 	return nil
 }
@@ -89,9 +146,7 @@ func (fsm *Fsm) Running() bool {
 // Completed
 // Checks if FSM execution is done and there's a result to grab
 func (fsm *Fsm) Completed() bool {
-	return !fsm.Fatal() &&
-		fsm.stack.Depth() > FsmAutoStatesCount &&
-		fsm.stack.Peek().state.Final()
+	return !fsm.Fatal() && fsm.stack.completed()
 }
 
 // Idle
@@ -132,16 +187,83 @@ func (fsm *Fsm) History() History {
 }
 
 // Advance
-// Event that makes state machine to transition to the next state
+// Makes state machine to transition to the next state
+// Only transitions that are not bound to an event are considered
 func (fsm *Fsm) Advance() (step HistoryItem, err *FsmError) {
-	current := fsm.stack.Peek()
-	currentName := current.state.Name
+	return fsm.AdvanceContext(context.Background())
+}
+
+// AdvanceContext
+// Same as Advance, but can be interrupted by ctx cancellation or deadline.
+// ctx is available to guards and actions via GoContext().
+// Interrupted step doesn't put FSM into fatal state, it can be resumed later
+// (though if callback was interrupted after state change, FSM stays in the new state)
+func (fsm *Fsm) AdvanceContext(ctx context.Context) (step HistoryItem, err *FsmError) {
+	defer func(finish func(*FsmError)) { finish(err) }(fsm.recordCall(RecordedAdvance, "", nil))
+	return fsm.step(ctx, "")
+}
+
+// Fire
+// Delivers named event to the state machine, transition is chosen
+// among the ones declared for this event.
+// Payload members (and event name itself, see FsmEventCtxMemberName)
+// are visible to guards and actions while the event is processed
+func (fsm *Fsm) Fire(event string, payload map[string]interface{}) (step HistoryItem, err *FsmError) {
+	return fsm.FireContext(context.Background(), event, payload)
+}
+
+// FireContext
+// Same as Fire, but can be interrupted by ctx cancellation or deadline (see AdvanceContext)
+func (fsm *Fsm) FireContext(ctx context.Context, event string, payload map[string]interface{}) (step HistoryItem, err *FsmError) {
+	defer func(finish func(*FsmError)) { finish(err) }(fsm.recordCall(RecordedFire, event, payload))
+	switch {
+	case event == "":
+		err = newFsmErrorInvalidArgument("event", "should be named")
+		return
+	case fsm.Idle():
+		err = newFsmErrorWrongFlow("fire an event", "idle")
+		return
+	}
+
+	fsm.stack.setEvent(event, payload)
+	defer fsm.stack.clearEvent()
+	fsm.loops.forget()
+
+	return fsm.step(ctx, event)
+}
+
+// step
+// Performs single transition, considering only transitions bound to given event
+// (empty event means unconditional/guarded transitions)
+func (fsm *Fsm) step(ctx context.Context, event string) (step HistoryItem, err *FsmError) {
+	ctx, span := fsm.startStepSpan(ctx, event)
+	defer func() { fsm.endStepSpan(span, &step, err) }()
+
+	fsm.stack.goCtx = ctx
+	fsm.attempts, fsm.guards, fsm.actions = nil, nil, nil
+	fsm.stepIdx = len(fsm.history)
+	defer func() {
+		if err != nil && !fsm.Fatal() {
+			fsm.logStepFailed(err)
+		}
+		fsm.stack.goCtx = nil
+	}()
 
 	// Process current FSM status
 	switch {
+	case ctx.Err() != nil:
+		err = newFsmErrorCancelled(ctx.Err())
+		return
+	case len(fsm.inDoubt) > 0:
+		err = newFsmErrorInDoubt(fsm.inDoubt)
+		return
+	case fsm.journal != nil && fsm.persistence == nil:
+		// journal is truncated on save, without a store it would grow forever
+		err = newFsmErrorWrongFlow("journal actions", "not bound to a store")
+		return
 	case fsm.Idle():
 		if err = fsm.structure.Validate(); err != nil {
-			fsm.goFatal(err)
+			fsm.fail(err)
 			return
 		}
 	case fsm.Completed():
@@ -152,95 +274,290 @@ func (fsm *Fsm) Advance() (step HistoryItem, err *FsmError) {
 		return
 	}
 
-	// find target state by checking opened transitions
-	var transition *Transition
-	var openedTransitionCount int
-	for idx := range current.state.Transitions {
-		currTransition := &current.state.Transitions[idx]
-		open, e := currTransition.Guard(&fsm.stack)
-		if e != nil {
-			err = newFsmErrorCallbackFailed("guard", e)
-			fsm.goFatal(err)
+	// FSM gone fatal is saved as such, so it won't be loaded to repeat the failed step
+	// (its compensations are already executed), step error is reported rather than failed save
+	defer func() {
+		if !fsm.Fatal() {
 			return
 		}
-		if open {
-			transition = currTransition
-			openedTransitionCount++
+		if e := fsm.persist(); e != nil {
+			fsm.log(slog.LevelError, "fatal state is not saved", errorAttrs(e)...)
+		}
+	}()
+
+	if step, err = fsm.stepStack(&fsm.stack, event); err != nil {
+		fsm.fail(err)
+		return
+	}
+	// journaled actions not met while repeating the step are stale
+	fsm.replay = nil
+
+	// completion is reported only for the step that passed all the checks
+	if err = fsm.loops.check(fsm.history, &fsm.stack); err != nil {
+		fsm.fail(err)
+		return
+	}
+	if fsm.Completed() {
+		result, _ := fsm.Result()
+		fsm.log(slog.LevelInfo, "completed")
+		fsm.notify(func(l Listener) { l.OnCompleted(len(fsm.history)-1, result) })
+	}
+
+	err = fsm.persist()
+	return
+}
+
+// stepStack
+// Performs single transition within given (root or region) stack
+// Failed guard or action makes FSM take an error transition of the active states
+// (innermost first), if there's none, the failure is passed to outer stack
+func (fsm *Fsm) stepStack(stack *ContextStack, event string) (step HistoryItem, err *FsmError) {
+	if step, err = fsm.advanceStack(stack, event); err != nil && err.Kind() == ErrFsmCallbackFailed {
+		step, err = fsm.handleError(stack, err)
+	}
+	return
+}
+
+// advanceStack
+// Selects a transition to take within given (root or region) stack
+// Transitions of all active states in the stack are considered, starting
+// from the head or from the bottom according to precedence.
+// Parallel state at the head of the stack delegates the step to its regions
+// until all of them are completed, then its done transitions are considered
+func (fsm *Fsm) advanceStack(stack *ContextStack, event string) (step HistoryItem, err *FsmError) {
+	current := stack.Peek()
+	currentName := current.state.Name
+
+	// regions are inner to the parallel state, they go first if inner states have precedence
+	var regionsErr *FsmError
+	regions := current.state.Parallel() && !current.regionsCompleted()
+	if regions && fsm.precedence == PrecedenceInner {
+		if step, regionsErr = fsm.stepRegions(current, event); !unhandled(regionsErr) {
+			err = regionsErr
+			return
 		}
 	}
 
+	// find target state by checking opened transitions
+	transition, awaitsEvent, err := fsm.selectStackTransition(stack, event)
+	if err != nil {
+		return
+	}
+
 	// * if there are some but no one fits, error
-	// * if there are some and several fits, error
-	var next *StateInfo
-	switch openedTransitionCount {
-	case 0:
+	//   (not fatal if the state can be left by an event)
+	switch {
+	case transition == nil && regionsErr != nil:
+		err = regionsErr
+	case transition == nil && regions:
+		step, err = fsm.stepRegions(current, event)
+	case transition == nil && event != "":
+		err = newFsmErrorEventUnhandled(event, currentName)
+	case transition == nil && awaitsEvent:
+		err = newFsmErrorAwaitingEvent(currentName)
+	case transition == nil:
 		err = newFsmErrorRuntime("all transitions are closed", current)
-	case 1:
-		next = fsm.structure.states[transition.ToState]
 	default:
-		err = newFsmErrorRuntime("more than 1 transitions are opened", current)
+		step, err = fsm.take(stack, transition, event, nil)
 	}
+	return
+}
+
+// take
+// Makes given transition from the head of the stack
+// Carried members are put to the context of the target state before it's entered
+func (fsm *Fsm) take(stack *ContextStack, transition *stackTransition, event string, carry *Context) (step HistoryItem, err *FsmError) {
+	fsm.stepIdx = len(fsm.history)
+	currentName := stack.Peek().state.Name
+	nextName, recall := historyTarget(transition.ToState)
+	next := fsm.structure.states[nextName]
 	if next == nil {
-		fsm.goFatal(err)
+		cause := fmt.Sprintf("transition \"%s\" has unknown destination \"%s\"", transition.Name, nextName)
+		err = newFsmErrorRuntime(cause, fsm.structure.states)
 		return
 	}
 
-	// pop the stack until common parent is found for current and next states
-	var depthDiff int
-	ancestor, depthDiff := findCommonAncestor(current.state, next)
-	if ancestor == nil {
+	// budgets are checked before anything is done
+	// (state the step ends in is known only once pseudo-states are passed, see below)
+	target := next
+	if next.Pseudo != PseudoNone {
+		target = nil
+	}
+	if err = fsm.admit(stack, currentName, transition, target, recall); err != nil {
+		return
+	}
+
+	fsm.started = fsm.clock.Now()
+	fsm.notify(func(l Listener) { l.OnTransitionStart(fsm.stepIdx, transition.source, transition.Transition) })
+	fsm.observeTransition(transition.source, transition.Transition)
+
+	chain := compound{transition: transition.Transition, pending: []*stackTransition{transition}}
+	if transition.Kind == TransitionInternal {
+		if carry != nil {
+			fsm.carry(stack.ByState(transition.source.Name), carry)
+		}
+		return fsm.finishStep(stack, currentName, &chain, event)
+	}
+
+	if ancestor, _ := findCommonAncestor(transition.source, next); ancestor == nil {
 		cause := fmt.Sprintf("\"%s\" and \"%s\" don't have a common parent", currentName, next.Name)
 		err = newFsmErrorRuntime(cause, fsm.structure.states)
-		fsm.goFatal(err)
 		return
 	}
-	switch {
-	case depthDiff == -1:
-		// meaning we go from parent state to substate,
-		// no need to pop anything from the stack
-	case depthDiff < -1:
-		err = newFsmErrorRuntime("Trying to go deeper than 1 state at a time", current.state)
-		fsm.goFatal(err)
-		return
-	case depthDiff >= 0:
-		for idx := 0; idx < depthDiff+1; idx++ {
-			if fsm.stack.Depth() <= FsmAutoStatesCount {
-				break
+
+	// pass pseudo-states (if any) until a real target is found
+	for hops := 0; next.Pseudo != PseudoNone; hops++ {
+		if hops > len(fsm.structure.states) {
+			err = newFsmErrorRuntime("pseudo-states form a cycle", chain.path)
+			return
+		}
+		if next, recall, err = fsm.passPseudo(stack, next, &chain); err != nil {
+			return
+		}
+		if next.Pseudo == PseudoNone {
+			if err = fsm.admit(stack, currentName, transition, next, recall); err != nil {
+				return
 			}
-			fsm.stack.Pop()
 		}
 	}
 
-	// Prepare new stack, log and execute transition action
-	if fsm.stack.Push(next) == nil {
-		err = newFsmErrorRuntime("pushing new state to the stack failed", next)
-		fsm.goFatal(err)
+	// pop the stack until common parent is found for current and next states
+	// (target that is current state or its ancestor is exited and entered again)
+	if err = fsm.exit(stack, next, &chain); err != nil {
 		return
 	}
+	fsm.remember(chain.exited)
 
+	// Prepare new stack: enter all intermediate states down to the target
+	// History pseudo-state brings remembered sub states back,
+	// composite states are descended into via their start sub states
+	if err = fsm.enter(stack, next, carry); err != nil {
+		return
+	}
+	if recall {
+		if err = fsm.recall(stack, next); err != nil {
+			return
+		}
+	}
+	if err = fsm.descend(stack); err != nil {
+		return
+	}
+
+	return fsm.finishStep(stack, currentName, &chain, event)
+}
+
+// admit
+// Checks step budgets before the transition from given state is taken (see FsmLimits)
+// Internal transition doesn't change the state, other ones end in the state stack head is going to be at
+// Nil target means it's not known yet, only step budget is checked then
+func (fsm *Fsm) admit(stack *ContextStack, from string, transition *stackTransition, target *StateInfo, recall bool) *FsmError {
+	var to string
+	switch {
+	case transition.Kind == TransitionInternal:
+		to = stack.Peek().state.Name
+	case target != nil:
+		to = fsm.landing(stack, target, recall).Name
+	}
+	return fsm.loops.admit(fsm.history, from, to)
+}
+
+// finishStep
+// Logs the step made from given state and executes pending transition actions
+func (fsm *Fsm) finishStep(stack *ContextStack, from string, chain *compound, event string) (step HistoryItem, err *FsmError) {
 	step = HistoryItem{
-		currentName,
-		next.Name,
-		transition.Name,
+		number:     len(fsm.history),
+		from:       from,
+		to:         stack.Peek().state.Name,
+		transition: chain.transition.Name,
+		event:      event,
+		path:       chain.path,
+		start:      fsm.started,
 	}
+	step.guards, fsm.guards = fsm.guards, nil
 	fsm.history = append(fsm.history, step)
+	fsm.loops.register(fsm.history)
+	fsm.logStep(&step)
+	err = fsm.runActions(stack, chain)
+	step.end = fsm.clock.Now()
+	step.err = fsmError(err)
+
+	// attempts made by actions with retry policy during the step are logged as well,
+	// so are compensating actions of what has been done
+	step.actions, fsm.actions = fsm.actions, nil
+	step.attempts, fsm.attempts = fsm.attempts, nil
+	step.undo, fsm.undo = fsm.undo, nil
+	fsm.history[len(fsm.history)-1] = step
+	return
+}
+
+// runActions
+// Executes pending actions of the compound transition in order
+func (fsm *Fsm) runActions(stack *ContextStack, chain *compound) *FsmError {
+	pending := chain.pending
+	chain.pending = nil
+	for _, tr := range pending {
+		if tr.Action == nil {
+			continue
+		}
+		e := fsm.doTransitionAction(stack, tr)
+		fsm.notifyAction(tr.source, tr.Transition, "transition action", e)
+		if e != nil {
+			return fsm.callbackFailed("transition action", tr.source, e)
+		}
+		if tr.Compensation != nil {
+			fsm.undo = append(fsm.undo, compensation{tr.Name, tr.source, tr.Compensation})
+		}
+	}
+	return nil
+}
 
-	if transition.Action != nil {
-		if e := transition.Action.Do(&fsm.stack); e != nil {
-			err = newFsmErrorCallbackFailed("entry action", e)
-			fsm.goFatal(err)
+// stepRegions
+// Makes a step in every region of the parallel state that is not completed yet
+// Fired event is delivered to all regions, it's enough for one of them to handle it
+// Returns the last step made
+func (fsm *Fsm) stepRegions(current *StateContext, event string) (step HistoryItem, err *FsmError) {
+	var progressed bool
+	for _, region := range current.regions {
+		if region.completed() {
+			continue
+		}
+		s, e := fsm.stepStack(region, event)
+		switch {
+		case e == nil:
+			step, progressed = s, true
+		case unhandled(e):
+			// other regions may still progress
+		default:
+			err = e
+			return
 		}
 	}
 
-	// TODO: error detection: infinite transition loop
+	if !progressed {
+		if event != "" {
+			err = newFsmErrorEventUnhandled(event, current.state.Name)
+		} else {
+			err = newFsmErrorAwaitingEvent(current.state.Name)
+		}
+	}
 	return
 }
 
 // Run
 // Executes whole FSM until it's completed or failed
 func (fsm *Fsm) Run() (res interface{}, err *FsmError) {
+	return fsm.RunContext(context.Background())
+}
+
+// RunContext
+// Same as Run, but stops between steps when ctx is cancelled or its deadline is exceeded
+// Stopped FSM is not fatal and can be resumed
+func (fsm *Fsm) RunContext(ctx context.Context) (res interface{}, err *FsmError) {
+	ctx, span := fsm.startSpan(ctx, "fsm.run")
+	defer func() { endSpan(span, fsmError(err)) }()
+
 	for !fsm.Completed() && !fsm.Fatal() && err == nil {
-		_, err = fsm.Advance()
+		_, err = fsm.AdvanceContext(ctx)
 	}
 	if fsm.Completed() {
 		res, err = fsm.Result()
@@ -248,6 +565,302 @@ func (fsm *Fsm) Run() (res interface{}, err *FsmError) {
 	return
 }
 
+// selectStackTransition
+// Looks for a transition to take among the ones of active states in the stack
+// States are visited according to precedence, the first one having
+// an opened transition wins (conflicts are resolved within a state)
+// Composite state at the head of the stack is left via its start sub state
+// Done transitions are offered by parallel state at the head of the stack
+// once all of its regions are completed and by composite state
+// once its active sub state is final
+func (fsm *Fsm) selectStackTransition(stack *ContextStack, event string) (transition *stackTransition, awaitsEvent bool, err *FsmError) {
+	depth := stack.Depth()
+	for idx := 0; idx < depth; idx++ {
+		level := idx
+		if fsm.precedence == PrecedenceInner {
+			level = depth - 1 - idx
+		}
+		sc := &stack.stack[level]
+
+		transitions := sc.state.Transitions
+		switch {
+		case level == depth-1 && sc.state.StartSubState != nil:
+			transitions = []Transition{sc.state.startTransition()}
+		case level == depth-1 && sc.state.Parallel() && sc.regionsCompleted(),
+			level > 0 && level == depth-2 && stack.Peek().completed():
+			transitions = append(append([]Transition{}, sc.state.Done...), transitions...)
+		}
+
+		tr, awaits, e := fsm.selectTransition(stack, sc.state, transitions, event)
+		if e != nil {
+			err = e
+			return
+		}
+		awaitsEvent = awaitsEvent || awaits
+		if tr != nil {
+			transition = &stackTransition{Transition: tr, source: sc.state}
+			return
+		}
+	}
+	return
+}
+
+// selectTransition
+// Evaluates guards of given transitions bound to given event
+// and picks the one to take according to conflict policy.
+// Returns nil transition if all of them are closed,
+// awaitsEvent reports whether there are transitions bound to other events
+func (fsm *Fsm) selectTransition(stack *ContextStack, state *StateInfo, transitions []Transition, event string) (transition *Transition, awaitsEvent bool, err *FsmError) {
+	var otherwise *Transition
+	candidates := make([]*Transition, 0, len(transitions))
+	for idx := range transitions {
+		tr := &transitions[idx]
+		switch {
+		case tr.Event != event:
+			awaitsEvent = awaitsEvent || tr.Event != ""
+		case tr.Else:
+			otherwise = tr
+		default:
+			candidates = append(candidates, tr)
+		}
+	}
+	if fsm.policy == ConflictFirstMatch {
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].Priority > candidates[j].Priority
+		})
+	}
+
+	var opened []string
+	for _, tr := range candidates {
+		start := fsm.measureStart()
+		open, e := fsm.traceGuard(stack, state, tr)
+		fsm.observeGuard(state, tr, start, e)
+		fsm.notify(func(l Listener) { l.OnGuardEvaluated(fsm.stepIdx, state, tr, open, e) })
+		fsm.logGuard(state, tr, open, e)
+		fsm.guards = append(fsm.guards, GuardOutcome{state.Name, tr.Name, open, e})
+		if e != nil {
+			err = fsm.callbackFailed("guard", state, e)
+			return
+		}
+		if !open {
+			continue
+		}
+		if transition == nil {
+			transition = tr
+		}
+		if fsm.policy == ConflictFirstMatch {
+			break
+		}
+		opened = append(opened, tr.Name)
+	}
+
+	if transition == nil {
+		transition = otherwise
+	}
+	if len(opened) > 1 {
+		transition = nil
+		if fsm.policy == ConflictError {
+			err = newFsmErrorConflict(state.Name, opened)
+		} else {
+			err = newFsmErrorRuntime("more than 1 transitions are opened", state)
+		}
+	}
+	return
+}
+
+// pushState
+// Pushes new state to the stack and executes its entry action
+// Restored context members (if any) are put to the new state context beforehand
+// Regions of parallel state are entered right after the state itself
+func (fsm *Fsm) pushState(stack *ContextStack, state *StateInfo, restored *Context) *FsmError {
+	head := stack.Push(state)
+	if head == nil {
+		return newFsmErrorRuntime("pushing new state to the stack failed", state)
+	}
+	fsm.markEntered(head)
+	if restored != nil {
+		fsm.carry(head, restored)
+	}
+	if state.OnEnter != nil {
+		e := fsm.doAction(stack, "state entry action", state.Name, state.OnEnter)
+		fsm.notifyAction(state, nil, "state entry action", e)
+		if e != nil {
+			return fsm.callbackFailed("state entry action", state, e)
+		}
+	}
+	if state.Compensation != nil {
+		fsm.undo = append(fsm.undo, compensation{state.Name, nil, state.Compensation})
+	}
+	fsm.notify(func(l Listener) { l.OnStateEnter(fsm.stepIdx, state) })
+	for _, region := range state.Regions {
+		regionStack := newRegionStack(stack)
+		head.regions = append(head.regions, regionStack)
+		if err := fsm.pushState(regionStack, region, nil); err != nil {
+			return err
+		}
+		if err := fsm.descend(regionStack); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exit
+// Pops the stack until its head is an ancestor of target state
+// Popped states are collected by the compound transition
+func (fsm *Fsm) exit(stack *ContextStack, target *StateInfo, chain *compound) *FsmError {
+	for stack.Depth() > FsmAutoStatesCount && !stack.Peek().state.ancestorOf(target) {
+		popped := *stack.Peek()
+		if err := fsm.popState(stack); err != nil {
+			return err
+		}
+		chain.exited = append(chain.exited, popped)
+	}
+	return nil
+}
+
+// enter
+// Pushes target state to the stack along with all its ancestors
+// that are not on the stack yet, outermost first
+// Carried members (if any) are put to the target state context
+func (fsm *Fsm) enter(stack *ContextStack, target *StateInfo, carry *Context) *FsmError {
+	var path []*StateInfo
+	for curr := target; curr != stack.Peek().state; curr = curr.Parent {
+		if curr == nil {
+			return newFsmErrorRuntime("target state is not a descendant of stack head", target)
+		}
+		path = append([]*StateInfo{curr}, path...)
+	}
+	for idx, state := range path {
+		var restored *Context
+		if idx == len(path)-1 {
+			restored = carry
+		}
+		if err := fsm.pushState(stack, state, restored); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// descend
+// Follows start sub states of the head state until simple (or parallel) state is entered
+func (fsm *Fsm) descend(stack *ContextStack) *FsmError {
+	for head := stack.Peek().state; head.StartSubState != nil; head = stack.Peek().state {
+		if err := fsm.pushState(stack, head.StartSubState, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// popState
+// Executes exit action of the head state and pops it from the stack
+// Regions of parallel state are exited before the state itself
+func (fsm *Fsm) popState(stack *ContextStack) *FsmError {
+	head := stack.Peek()
+	for _, region := range head.regions {
+		for !region.Empty() {
+			if err := fsm.popState(region); err != nil {
+				return err
+			}
+		}
+	}
+	if head.state.OnExit != nil {
+		e := fsm.doAction(stack, "state exit action", head.state.Name, head.state.OnExit)
+		fsm.notifyAction(head.state, nil, "state exit action", e)
+		if e != nil {
+			return fsm.callbackFailed("state exit action", head.state, e)
+		}
+	}
+	popped := stack.Pop()
+	fsm.observeExit(popped)
+	state := popped.state
+	fsm.notify(func(l Listener) { l.OnStateExit(fsm.stepIdx, state) })
+	return nil
+}
+
+// stackTransition
+// Transition selected for a step along with the state declaring it
+type stackTransition struct {
+	*Transition
+	source *StateInfo
+}
+
+// unhandled
+// Checks if step error means nothing happened because no transition was opened
+func unhandled(err *FsmError) bool {
+	return err != nil && (err.Kind() == ErrFsmAwaitingEvent || err.Kind() == ErrFsmEventUnhandled)
+}
+
+// handleError
+// Looks for an opened error transition of the state failed callback belongs to,
+// then of its ancestors. States outside of given stack are left to the outer one.
+// Error returned by the callback is put to the target state context
+// (see FsmErrorCtxMemberName). Failed error transition is fatal
+func (fsm *Fsm) handleError(stack *ContextStack, cause *FsmError) (step HistoryItem, err *FsmError) {
+	if fsm.Fatal() {
+		return step, cause
+	}
+	bottom := stack.stack[0].state
+	for state := fsm.failedIn; state != nil; state = state.Parent {
+		if state != bottom && !bottom.ancestorOf(state) {
+			fsm.failedIn = state
+			return step, cause
+		}
+		tr, _, e := fsm.selectTransition(stack, state, state.OnError, "")
+		if e != nil {
+			fsm.fail(e)
+			return step, e
+		}
+		if tr == nil {
+			continue
+		}
+
+		fsm.failedIn = nil
+		carry := newContext()
+		carry.Put(FsmErrorCtxMemberName, cause.Unwrap())
+		if step, err = fsm.take(stack, &stackTransition{Transition: tr, source: state}, "", &carry); err != nil {
+			fsm.fail(err)
+		}
+		return
+	}
+	return step, cause
+}
+
+// carry
+// Puts carried members to given state context
+func (fsm *Fsm) carry(sc *StateContext, carry *Context) {
+	if sc == nil {
+		return
+	}
+	for k, v := range carry.members {
+		sc.Put(k, v)
+	}
+}
+
+// callbackFailed
+// Constructs an error for failed guard/action, remembers the state it belongs to
+// Failures caused by interrupted run are reported as cancellation
+func (fsm *Fsm) callbackFailed(who string, state *StateInfo, e error) *FsmError {
+	if ctx := fsm.stack.goCtx; ctx != nil && ctx.Err() != nil {
+		return newFsmErrorCancelled(ctx.Err())
+	}
+	fsm.failedIn = state
+	return newFsmErrorCallbackFailed(who, e)
+}
+
+// fail
+// Puts FSM into fatal state unless the error is recoverable
+// (conflicting transitions, cancellation, missing or unhandled event)
+func (fsm *Fsm) fail(cause *FsmError) {
+	switch cause.Kind() {
+	case ErrFsmConflict, ErrFsmCancelled, ErrFsmAwaitingEvent, ErrFsmEventUnhandled:
+		return
+	}
+	fsm.goFatal(cause)
+}
+
 func (fsm *Fsm) goFatal(cause *FsmError) {
 	if fsm.Fatal() {
 		return
@@ -257,6 +870,10 @@ func (fsm *Fsm) goFatal(cause *FsmError) {
 		Dump(&fsm.stack),
 		fsm.history,
 	)
+	fsm.log(slog.LevelError, "fatal", errorAttrs(cause)...)
+	fsm.observeFatal(cause)
+	fsm.compensate()
+	fsm.notify(func(l Listener) { l.OnFatal(fsm.stepIdx, fsm.fatal) })
 }
 
 // Dump
@@ -1,7 +1,11 @@
 package simple_fsm
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestFsmReset(t *testing.T) {
@@ -165,32 +169,47 @@ func TestFsmAdvanceGuardError(t *testing.T) {
 	}
 }
 
-func TestFsmAdvanceTransitionError(t *testing.T) {
+func TestFsmAdvanceDeepTarget(t *testing.T) {
+	var entered []string
+	enter := func(name string) *PackagedAction {
+		return NewAction(func(ctx ContextOperator) error {
+			entered = append(entered, name)
+			return nil
+		})
+	}
+
 	fstr := NewStructure()
-	s1, s2, s3 := NewState("1", nil), NewState("2", nil), NewState("3", NewTransitionAlways("3-11", "s11", nil))
+	s1 := NewState("1", nil).Entry(enter("1"))
+	s2 := NewState("2", nil).Entry(enter("2"))
+	s3 := NewState("3", NewTransitionAlways("3-11", "s11", nil)).Entry(enter("3"))
 	fstr.AddStartState(s1, nil)
 	fstr.AddStartState(s2, s1)
 	fstr.AddStartState(s3, s2)
-	tr_list := []Transition{
-		NewTransition("11-1", "1", func(ctx ContextAccessor) (bool, error) { return false, nil }, nil),
-		NewTransition("11-3", "3", func(ctx ContextAccessor) (bool, error) { return true, nil }, nil),
-	}
-	fstr.AddState(NewState("s11", tr_list), nil)
+	fstr.AddState(NewState("s11", NewTransitionAlways("11-3", "3", nil)), nil)
 
 	fsm := NewFsm(fstr)
 
+	if step, err := fsm.Advance(); err != nil || step.to != "3" || fsm.stack.Depth() != 4 {
+		t.Logf("Start sub states should be entered within a single step, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
 	fsm.Advance()
-	fsm.Advance()
-	fsm.Advance()
-	fsm.Advance()
-	if _, err := fsm.Advance(); err == nil || err.Kind() != ErrFsmRuntime {
-		t.Log("FSM should be invalid (can't go deeper that 1 state per transition)")
+	entered = nil
+	if step, err := fsm.Advance(); err != nil || step.to != "3" || fsm.stack.Depth() != 4 {
+		t.Logf("Transition to deeply nested state should succeed, error: %v", err)
 		t.Log(Dump(fsm))
 		t.FailNow()
 	}
+	if strings.Join(entered, ",") != "1,2,3" {
+		t.Logf("Intermediate states should be entered outermost first: %v", entered)
+		t.FailNow()
+	}
+}
 
+func TestFsmAdvanceTransitionError(t *testing.T) {
 	fail := NewAction(func(ctx ContextOperator) error { return newFsmErrorRuntime("fail", nil) })
-	fsm = NewFsm(MakeStructure(nil,
+	fsm := NewFsm(MakeStructure(nil,
 		NewState("1", NewTransitionAlways("1-2", "2", fail)),
 		NewState("2", nil),
 	))
@@ -257,3 +276,460 @@ func TestFsmRunResult(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestFsmFireEvent(t *testing.T) {
+	approved := func(ctx ContextAccessor) (bool, error) {
+		open, err := ctx.Bool("approved")
+		if err != nil {
+			return false, err
+		}
+		return open, nil
+	}
+	rejected := func(ctx ContextAccessor) (bool, error) {
+		open, err := approved(ctx)
+		return !open, err
+	}
+	store := NewAction(func(ctx ContextOperator) error {
+		who, err := ctx.Str("who")
+		if err != nil {
+			return err
+		}
+		ctx.PutResult(who)
+		return nil
+	})
+	fsm := NewFsm(MakeStructure(nil,
+		NewState("draft", []Transition{
+			NewEventTransition("draft-approved", "review", "approved", approved, store),
+			NewEventTransition("draft-rejected", "review", "rejected", rejected, nil),
+		}),
+		NewState("approved", nil),
+		NewState("rejected", nil),
+	))
+
+	if _, err := fsm.Fire("review", nil); err == nil || err.Kind() != ErrFsmWrongFlow {
+		t.Log("Firing events should not be allowed while FSM is idle")
+		t.FailNow()
+	}
+	if _, err := fsm.Fire("", nil); err == nil || err.Kind() != ErrFsmInvalidArgument {
+		t.Logf("Unnamed event should be rejected as invalid argument: %v", err)
+		t.FailNow()
+	}
+
+	if _, err := fsm.Run(); err == nil || err.Kind() != ErrFsmAwaitingEvent || !fsm.Running() {
+		t.Logf("FSM should stop and wait for an event, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+
+	if _, err := fsm.Fire("unknown", nil); err == nil || err.Kind() != ErrFsmEventUnhandled || !fsm.Running() {
+		t.Logf("Unknown event should be reported without stopping FSM, error: %v", err)
+		t.FailNow()
+	}
+
+	step, err := fsm.Fire("review", map[string]interface{}{"approved": true, "who": "boss"})
+	if err != nil || step.to != "approved" || step.event != "review" {
+		t.Logf("Event should lead to \"approved\" state, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+	if res, err := fsm.Result(); err != nil || res != "boss" {
+		t.Logf("Action should see event payload, result: %v, error: %v", res, err)
+		t.FailNow()
+	}
+	if fsm.stack.Has("who") {
+		t.Log("Event payload should not outlive event processing")
+		t.FailNow()
+	}
+}
+
+func TestFsmStateActions(t *testing.T) {
+	var trace []string
+	record := func(what string) *PackagedAction {
+		return NewAction(func(ctx ContextOperator) error { trace = append(trace, what); return nil })
+	}
+
+	fstr := NewStructure()
+	outer := NewState("outer", nil).Entry(record("enter outer")).Exit(record("exit outer"))
+	inner := NewState("inner", NewTransitionAlways("inner-next", "next", record("inner-next")))
+	inner.Entry(record("enter inner")).Exit(record("exit inner"))
+	fstr.AddStartState(outer, nil)
+	fstr.AddStartState(inner, outer)
+	fstr.AddState(NewState("next", nil).Entry(record("enter next")), nil)
+
+	fsm := NewFsm(fstr)
+	if fsm.Run(); !fsm.Completed() {
+		t.Log("FSM should complete")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+
+	expected := []string{
+		"enter outer", "enter inner",
+		"exit inner", "exit outer",
+		"enter next", "inner-next",
+	}
+	if len(trace) != len(expected) {
+		t.Logf("Actions trace is different from expected: %v", trace)
+		t.FailNow()
+	}
+	for idx := range expected {
+		if trace[idx] != expected[idx] {
+			t.Logf("Actions trace is different from expected: %v", trace)
+			t.FailNow()
+		}
+	}
+
+	fail := NewAction(func(ctx ContextOperator) error { return newFsmErrorRuntime("fail", nil) })
+	fsm = NewFsm(MakeStructure(nil,
+		NewState("1", NewTransitionAlways("1-2", "2", nil)).Exit(fail),
+		NewState("2", nil),
+	))
+	if _, err := fsm.Run(); err == nil || !fsm.Fatal() {
+		t.Log("FSM should fail (exit action failed)")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+}
+
+func TestFsmConflictPolicy(t *testing.T) {
+	open := func(ctx ContextAccessor) (bool, error) { return true, nil }
+	structure := func() *Structure {
+		return MakeStructure(nil,
+			NewState("1", []Transition{
+				NewTransition("1-fallback", "fallback", open, nil),
+				NewTransition("1-specific", "specific", open, nil).Prioritize(1),
+				NewTransition("1-other", "other", open, nil).Prioritize(1),
+			}),
+			NewState("fallback", nil),
+			NewState("specific", nil),
+			NewState("other", nil),
+		)
+	}
+
+	fsm := NewFsm(structure())
+	fsm.Advance()
+	if _, err := fsm.Advance(); err == nil || err.Kind() != ErrFsmRuntime || !fsm.Fatal() {
+		t.Log("FSM should be fatal (strict policy, >1 opened guards)")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+
+	fsm = NewFsm(structure(), WithConflictPolicy(ConflictFirstMatch))
+	fsm.Advance()
+	if step, err := fsm.Advance(); err != nil || step.to != "specific" {
+		t.Logf("Highest priority transition declared first should be taken, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+
+	fsm = NewFsm(structure(), WithConflictPolicy(ConflictError))
+	fsm.Advance()
+	if _, err := fsm.Advance(); err == nil || err.Kind() != ErrFsmConflict || !fsm.Running() {
+		t.Logf("Conflict should be reported without stopping FSM, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+}
+
+func TestFsmRunContext(t *testing.T) {
+	wait := NewAction(func(ctx ContextOperator) error {
+		select {
+		case <-GoContext(ctx).Done():
+			return GoContext(ctx).Err()
+		case <-time.After(time.Second):
+			return nil
+		}
+	})
+	succ := NewAction(func(ctx ContextOperator) error { ctx.PutResult(true); return nil })
+	fsm := NewFsm(MakeStructure(nil,
+		NewState("1", NewTransitionAlways("1-2", "2", wait)),
+		NewState("2", NewTransitionAlways("2-3", "3", succ)),
+		NewState("3", nil),
+	))
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := fsm.RunContext(cancelled); err == nil || err.Kind() != ErrFsmCancelled || !fsm.Idle() {
+		t.Logf("FSM should not start with cancelled context, error: %v", err)
+		t.FailNow()
+	}
+
+	expiring, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := fsm.RunContext(expiring)
+	if err == nil || err.Kind() != ErrFsmCancelled || !errors.Is(err, context.DeadlineExceeded) {
+		t.Logf("FSM should be interrupted by deadline, error: %v", err)
+		t.FailNow()
+	}
+	if fsm.Fatal() || !fsm.Running() {
+		t.Log("Interrupted FSM should stay resumable")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+
+	if res, err := fsm.Run(); err != nil || res != true {
+		t.Logf("Resumed FSM should complete, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+}
+
+func makeParallelStructure(trace *[]string) *Structure {
+	record := func(what string) *PackagedAction {
+		return NewAction(func(ctx ContextOperator) error { *trace = append(*trace, what); return nil })
+	}
+
+	fstr := NewStructure()
+	checkout := NewState("checkout", nil).Exit(record("exit checkout"))
+	checkout.Done = NewTransitionAlways("checkout-finished", "finished", nil)
+	fstr.AddStartState(checkout, nil)
+
+	payment, shipping := NewState("payment", nil), NewState("shipping", nil)
+	fstr.AddRegion(payment, checkout)
+	fstr.AddRegion(shipping, checkout)
+
+	fstr.AddStartState(NewState("unpaid", []Transition{
+		NewEventTransition("unpaid-paid", "pay", "paid", nil, NewAction(func(ctx ContextOperator) error {
+			ctx.PutParent("amount", 42)
+			return nil
+		})),
+	}), payment)
+	fstr.AddState(NewState("paid", nil).Exit(record("exit paid")), payment)
+
+	fstr.AddStartState(NewState("packing", NewTransitionAlways("packing-shipped", "shipped", nil)), shipping)
+	fstr.AddState(NewState("shipped", nil).Exit(record("exit shipped")), shipping)
+
+	fstr.AddState(NewState("finished", nil), nil)
+	return fstr
+}
+
+func TestFsmParallelRegions(t *testing.T) {
+	var trace []string
+	fsm := NewFsm(makeParallelStructure(&trace))
+
+	if _, err := fsm.Run(); err == nil || err.Kind() != ErrFsmAwaitingEvent || !fsm.Running() {
+		t.Logf("FSM should wait for payment, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+	regions := fsm.stack.Peek().regions
+	if fsm.stack.Peek().state.Name != "checkout" || len(regions) != 2 ||
+		regions[0].Peek().state.Name != "unpaid" || regions[1].Peek().state.Name != "shipped" {
+		t.Log("Shipping region should progress independently from payment one")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+
+	if _, err := fsm.Fire("pay", nil); err != nil {
+		t.Logf("Payment region should handle the event, error: %v", err)
+		t.FailNow()
+	}
+	if amount, err := regions[0].Int("amount"); err != nil || amount != 42 {
+		t.Log("Region contexts should be readable from region states")
+		t.FailNow()
+	}
+	if fsm.stack.Has("amount") {
+		t.Log("Region contexts should not be visible outside of the region")
+		t.FailNow()
+	}
+
+	if fsm.Run(); !fsm.Completed() || fsm.stack.Peek().state.Name != "finished" {
+		t.Log("FSM should leave parallel state when all regions are done")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+
+	expected := []string{"exit paid", "exit shipped", "exit checkout"}
+	if len(trace) != len(expected) {
+		t.Logf("Regions should be exited before parallel state: %v", trace)
+		t.FailNow()
+	}
+	for idx := range expected {
+		if trace[idx] != expected[idx] {
+			t.Logf("Regions should be exited before parallel state: %v", trace)
+			t.FailNow()
+		}
+	}
+}
+
+// makeCompositeStructure
+// "checkout" can be cancelled from any of its sub states,
+// "address" state can go to "payment" on its own (by "next" event)
+func makeCompositeStructure() *Structure {
+	fstr := NewStructure()
+	checkout := NewState("checkout", []Transition{
+		NewEventTransition("checkout-cancelled", "cancel", "cancelled", nil, nil),
+		NewEventTransition("checkout-skipped", "next", "cancelled", nil, nil),
+	})
+	fstr.AddStartState(checkout, nil)
+	fstr.AddStartState(NewState("address", []Transition{
+		NewEventTransition("address-payment", "next", "payment", nil, nil),
+	}), checkout)
+	fstr.AddState(NewState("payment", nil), checkout)
+	fstr.AddState(NewState("cancelled", nil), nil)
+	return fstr
+}
+
+func TestFsmCompositeTransitions(t *testing.T) {
+	fsm := NewFsm(makeCompositeStructure())
+	if step, err := fsm.Advance(); err != nil || step.to != "address" {
+		t.Logf("FSM should enter composite state, error: %v", err)
+		t.FailNow()
+	}
+	if step, err := fsm.Fire("cancel", nil); err != nil || step.to != "cancelled" || step.transition != "checkout-cancelled" {
+		t.Logf("Composite state transition should be taken from a sub state, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+	if !fsm.Completed() || fsm.stack.Depth() != 2 {
+		t.Log("Composite state should be exited along with its sub state")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+}
+
+func TestFsmCompositePrecedence(t *testing.T) {
+	fsm := NewFsm(makeCompositeStructure())
+	fsm.Advance()
+	if step, err := fsm.Fire("next", nil); err != nil || step.to != "payment" {
+		t.Logf("Sub state transition should be preferred by default, error: %v", err)
+		t.FailNow()
+	}
+
+	fsm = NewFsm(makeCompositeStructure(), WithPrecedence(PrecedenceOuter))
+	fsm.Advance()
+	if step, err := fsm.Fire("next", nil); err != nil || step.to != "cancelled" {
+		t.Logf("Parent state transition should be preferred, error: %v", err)
+		t.FailNow()
+	}
+}
+
+func TestFsmParallelTransitions(t *testing.T) {
+	var trace []string
+	fstr := makeParallelStructure(&trace)
+	checkout := fstr.states["checkout"]
+	checkout.Transitions = []Transition{NewEventTransition("checkout-cancel", "cancel", "finished", nil, nil)}
+
+	fsm := NewFsm(fstr)
+	fsm.Run()
+	if step, err := fsm.Fire("cancel", nil); err != nil || step.to != "finished" || !fsm.Completed() {
+		t.Logf("Parallel state should be left while regions are active, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+	if len(trace) != 2 || trace[0] != "exit shipped" || trace[1] != "exit checkout" {
+		t.Logf("Regions should be exited before parallel state: %v", trace)
+		t.FailNow()
+	}
+}
+
+func TestFsmNestedFinal(t *testing.T) {
+	archive := false
+	fstr := NewStructure()
+	order := NewState("order", nil)
+	order.Done = []Transition{
+		NewTransition("order-archived", "archived", func(ctx ContextAccessor) (bool, error) { return archive, nil }, nil),
+	}
+	fstr.AddStartState(order, nil)
+	fstr.AddStartState(NewState("placing", NewTransitionAlways("placing-placed", "placed", nil)), order)
+	fstr.AddState(NewState("placed", nil), order)
+	fstr.AddState(NewState("archived", nil), nil)
+
+	fsm := NewFsm(fstr)
+	fsm.Advance()
+	if fsm.Advance(); fsm.Completed() || fsm.stack.Peek().state.Name != "placed" {
+		t.Log("Nested final state should not complete FSM")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+	if _, err := fsm.Advance(); err == nil || !fsm.Fatal() {
+		t.Log("Composite state should not be left while done transitions are closed")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+
+	archive = true
+	fsm = NewFsm(fstr)
+	if fsm.Run(); !fsm.Completed() || fsm.stack.Peek().state.Name != "archived" {
+		t.Log("Composite state should be left by done transition once its sub state is final")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+}
+
+func TestFsmSelfTransitions(t *testing.T) {
+	var trace []string
+	record := func(what string) *PackagedAction {
+		return NewAction(func(ctx ContextOperator) error {
+			trace = append(trace, what)
+			return nil
+		})
+	}
+
+	fstr := NewStructure()
+	fstr.AddStartState(NewState("polling", []Transition{
+		NewEventTransition("polling-again", "retry", "polling", nil, record("again")),
+		NewEventTransition("polling-tick", "tick", "polling", nil, record("tick")).Internal(),
+		NewEventTransition("polling-done", "stop", "done", nil, nil),
+	}).Entry(record("enter")).Exit(record("exit")), nil)
+	fstr.AddState(NewState("done", nil), nil)
+
+	fsm := NewFsm(fstr)
+	fsm.Advance()
+	if step, err := fsm.Fire("retry", nil); err != nil || step.to != "polling" {
+		t.Logf("External self-transition should succeed, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+	if strings.Join(trace, ",") != "enter,exit,enter,again" {
+		t.Logf("External self-transition should exit and enter the state again: %v", trace)
+		t.FailNow()
+	}
+
+	trace = nil
+	fsm.stack.Put("kept", true)
+	if step, err := fsm.Fire("tick", nil); err != nil || step.to != "polling" || step.transition != "polling-tick" {
+		t.Logf("Internal self-transition should succeed, error: %v", err)
+		t.FailNow()
+	}
+	if strings.Join(trace, ",") != "tick" || !fsm.stack.Has("kept") || fsm.stack.Depth() != 2 {
+		t.Logf("Internal self-transition should only execute transition action: %v", trace)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+}
+
+func TestFsmErrorTransitions(t *testing.T) {
+	declined := errors.New("payment declined")
+	charge := NewAction(func(ctx ContextOperator) error { return declined })
+
+	fstr := NewStructure()
+	checkout := NewState("checkout", nil).Catch(NewTransitionAlways("checkout-failed", "failed", nil))
+	fstr.AddStartState(checkout, nil)
+	fstr.AddStartState(NewState("cart", []Transition{
+		NewEventTransition("cart-paid", "pay", "paid", nil, charge),
+	}).Catch([]Transition{NewEventTransition("cart-declined", "", "declined", nil, nil)}), checkout)
+	fstr.AddState(NewState("paid", nil), checkout)
+	fstr.AddState(NewState("declined", NewTransitionAlways("declined-paid", "paid", charge)), checkout)
+	fstr.AddState(NewState("failed", nil), nil)
+
+	fsm := NewFsm(fstr)
+	fsm.Advance()
+	if step, err := fsm.Fire("pay", nil); err != nil || step.to != "declined" || step.transition != "cart-declined" {
+		t.Logf("Error transition should be taken, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+	if cause, err := fsm.stack.Raw(FsmErrorCtxMemberName); err != nil || cause != declined {
+		t.Logf("Callback error should be put to the target state context: %v", cause)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+
+	// "paid" has no error transitions, so the error bubbles up to "checkout"
+	if step, err := fsm.Advance(); err != nil || step.to != "failed" || !fsm.Completed() {
+		t.Logf("Error should be handled by parent state, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+}
@@ -2,16 +2,261 @@ package simple_fsm
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
 	"strings"
+	"time"
 )
 
+// GuardOutcome
+// Guard of the transition declared by the state, evaluated while the step was made
+type GuardOutcome struct {
+	State      string
+	Transition string
+	Open       bool
+	Err        error
+}
+
+// ActionOutcome
+// Action executed while the step was made (all attempts included)
+// Name is transition or state name, depending on kind of the action (who)
+// Written holds context members it has put (parameters excluded), in order they were put first
+type ActionOutcome struct {
+	Who     string
+	Name    string
+	Params  map[string]interface{}
+	Written []string
+	Err     error
+}
+
+// newActionOutcome
+// Constructs outcome of executed action given context writes it has made
+func newActionOutcome(who string, name string, action *PackagedAction, writes []contextWrite, err error) ActionOutcome {
+	outcome := ActionOutcome{Who: who, Name: name, Err: err}
+	if len(action.Params) > 0 {
+		outcome.Params = make(map[string]interface{}, len(action.Params))
+		for k, v := range action.Params {
+			outcome.Params[k] = v
+		}
+	}
+	// parameters are put to the context by the action itself, they are not reported as written
+	seen := make(map[string]bool, len(writes))
+	for k := range action.Params {
+		seen[k] = true
+	}
+	for _, w := range writes {
+		if !seen[w.key] {
+			seen[w.key] = true
+			outcome.Written = append(outcome.Written, w.key)
+		}
+	}
+	return outcome
+}
+
+// AttemptOutcome
+// Single attempt of the action with retry policy (see RetryPolicy), attempts are counted from 1
+type AttemptOutcome struct {
+	Who    string
+	Number int
+	Err    error
+}
+
+// PendingCompensation
+// Compensating action registered by the step, not executed yet (see Fsm.Compensate)
+// Compensation of the state entry if Transition is empty,
+// compensation of the transition declared by the state otherwise
+type PendingCompensation struct {
+	State      string
+	Transition string
+}
+
+// HistoryItem
+// Step made by FSM: transition taken, guards evaluated and actions executed on the way
+// Start and end times are taken from FSM clock (see WithClock)
 type HistoryItem struct {
+	number     int
 	from       string
 	to         string
 	transition string
+	event      string
+	path       []string        // pseudo-states and transitions passed after the first one
+	start      time.Time       // when the transition was started
+	end        time.Time       // when its actions were done
+	guards     []GuardOutcome  // guards evaluated to choose the transition
+	actions    []ActionOutcome // exit, entry and transition actions executed
+	err        error           // failure of transition actions (if any)
+	attempts   []actionAttempt // attempts of actions with retry policy
+	undo       []compensation  // compensations of actions executed and states entered
 }
 type History []HistoryItem
 
+// Step
+// Returns index of the item in FSM history
+func (it HistoryItem) Step() int {
+	return it.number
+}
+
+// From
+// Returns name of the state transition was taken from
+func (it HistoryItem) From() string {
+	return it.from
+}
+
+// To
+// Returns name of the state FSM ended up in
+func (it HistoryItem) To() string {
+	return it.to
+}
+
+// Transition
+// Returns name of the transition taken
+func (it HistoryItem) Transition() string {
+	return it.transition
+}
+
+// Event
+// Returns name of the event transition was taken on, empty if there's none
+func (it HistoryItem) Event() string {
+	return it.event
+}
+
+// Path
+// Returns pseudo-states and transitions passed after the first transition
+func (it HistoryItem) Path() []string {
+	return append([]string(nil), it.path...)
+}
+
+// Start
+// Returns time the transition was started at
+func (it HistoryItem) Start() time.Time {
+	return it.start
+}
+
+// End
+// Returns time the step was done at
+func (it HistoryItem) End() time.Time {
+	return it.end
+}
+
+// Guards
+// Returns guards evaluated to choose the transition, in order of evaluation
+func (it HistoryItem) Guards() []GuardOutcome {
+	return append([]GuardOutcome(nil), it.guards...)
+}
+
+// Actions
+// Returns actions executed during the step, in order of execution
+func (it HistoryItem) Actions() []ActionOutcome {
+	return append([]ActionOutcome(nil), it.actions...)
+}
+
+// Err
+// Returns failure of transition actions, nil if step succeeded
+func (it HistoryItem) Err() error {
+	return it.err
+}
+
+// Attempts
+// Returns attempts made by actions with retry policy during the step, in order they were made
+func (it HistoryItem) Attempts() []AttemptOutcome {
+	var attempts []AttemptOutcome
+	for _, attempt := range it.attempts {
+		attempts = append(attempts, AttemptOutcome{attempt.who, attempt.number, attempt.err})
+	}
+	return attempts
+}
+
+// Compensations
+// Returns compensating actions registered by the step that are still pending, in order they were registered
+func (it HistoryItem) Compensations() []PendingCompensation {
+	var pending []PendingCompensation
+	for _, undo := range it.undo {
+		pending = append(pending, undo.pending())
+	}
+	return pending
+}
+
+// jsonHistoryItem, jsonGuardOutcome, jsonActionOutcome, jsonAttemptOutcome, jsonCompensation
+// JSON representation of history items
+type jsonHistoryItem struct {
+	Step       int                  `json:"step"`
+	From       string               `json:"from"`
+	To         string               `json:"to"`
+	Transition string               `json:"transition"`
+	Event      string               `json:"event,omitempty"`
+	Path       []string             `json:"path,omitempty"`
+	Start      time.Time            `json:"start"`
+	End        time.Time            `json:"end"`
+	Guards     []jsonGuardOutcome   `json:"guards,omitempty"`
+	Actions    []jsonActionOutcome  `json:"actions,omitempty"`
+	Err        string               `json:"error,omitempty"`
+	Attempts   []jsonAttemptOutcome `json:"attempts,omitempty"`
+	Undo       []jsonCompensation   `json:"compensations,omitempty"`
+}
+type jsonGuardOutcome struct {
+	State      string `json:"state"`
+	Transition string `json:"transition"`
+	Open       bool   `json:"open"`
+	Err        string `json:"error,omitempty"`
+}
+type jsonActionOutcome struct {
+	Who     string                 `json:"who"`
+	Name    string                 `json:"name"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+	Written []string               `json:"written,omitempty"`
+	Err     string                 `json:"error,omitempty"`
+}
+type jsonAttemptOutcome struct {
+	Who    string `json:"who"`
+	Number int    `json:"number"`
+	Err    string `json:"error,omitempty"`
+}
+type jsonCompensation struct {
+	State      string `json:"state"`
+	Transition string `json:"transition,omitempty"`
+}
+
+// MarshalJSON
+// Implementation of json.Marshaler, History is marshalled as an array of items
+// Parameters that can't be marshalled are represented by their string form
+func (it HistoryItem) MarshalJSON() ([]byte, error) {
+	item := jsonHistoryItem{
+		Step:       it.number,
+		From:       it.from,
+		To:         it.to,
+		Transition: it.transition,
+		Event:      it.event,
+		Path:       it.path,
+		Start:      it.start,
+		End:        it.end,
+		Err:        errorString(it.err),
+	}
+	for _, guard := range it.guards {
+		item.Guards = append(item.Guards, jsonGuardOutcome{guard.State, guard.Transition, guard.Open, errorString(guard.Err)})
+	}
+	for _, action := range it.actions {
+		outcome := jsonActionOutcome{Who: action.Who, Name: action.Name, Written: action.Written, Err: errorString(action.Err)}
+		if len(action.Params) > 0 {
+			outcome.Params = make(map[string]interface{}, len(action.Params))
+			for k, v := range action.Params {
+				if _, e := json.Marshal(v); e != nil {
+					v = fmt.Sprintf("%v", v)
+				}
+				outcome.Params[k] = v
+			}
+		}
+		item.Actions = append(item.Actions, outcome)
+	}
+	for _, attempt := range it.attempts {
+		item.Attempts = append(item.Attempts, jsonAttemptOutcome{attempt.who, attempt.number, errorString(attempt.err)})
+	}
+	for _, undo := range it.undo {
+		pending := undo.pending()
+		item.Undo = append(item.Undo, jsonCompensation{pending.State, pending.Transition})
+	}
+	return json.Marshal(item)
+}
+
 // Dump
 // Print out an object in a user-friendly way
 func (h *History) Dump() string {
@@ -38,6 +283,26 @@ func (h *History) dump(buf *bytes.Buffer, indent int) {
 			buf.WriteString(it.to)
 			buf.WriteString(", transition: ")
 			buf.WriteString(it.transition)
+			for _, step := range it.path {
+				buf.WriteString(" -> ")
+				buf.WriteString(step)
+			}
+			if it.event != "" {
+				buf.WriteString(", event: ")
+				buf.WriteString(it.event)
+			}
+			if it.err != nil {
+				buf.WriteString(", error: ")
+				buf.WriteString(it.err.Error())
+			}
+			for _, attempt := range it.attempts {
+				buf.WriteString(fmt.Sprintf(", %s attempt %d: ", attempt.who, attempt.number))
+				if attempt.err != nil {
+					buf.WriteString(attempt.err.Error())
+				} else {
+					buf.WriteString("ok")
+				}
+			}
 			buf.WriteString("\n")
 		}
 	}
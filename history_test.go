@@ -0,0 +1,165 @@
+package simple_fsm
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistoryItemOutcomes(t *testing.T) {
+	fsm := NewFsm(makeCheckoutStructure(false), WithClock(&tickingClock{tick: time.Second}))
+	fsm.SetInput("items", 3)
+	if _, err := fsm.Run(); err != nil {
+		t.Logf("Run failed: %s", err.Error())
+		t.FailNow()
+	}
+
+	history := fsm.History()
+	if len(history) != 2 {
+		t.Logf("Unexpected history length: %d", len(history))
+		t.FailNow()
+	}
+	it := history[1]
+	if it.Step() != 1 || it.From() != "cart" || it.To() != "paid" || it.Transition() != "cart-paid" || it.Event() != "" || it.Err() != nil {
+		t.Logf("History item is different from expected:\n%s", history.Dump())
+		t.FailNow()
+	}
+	if !it.End().After(it.Start()) || it.Start().Before(history[0].End()) {
+		t.Logf("Step times are not ordered: %v - %v", it.Start(), it.End())
+		t.FailNow()
+	}
+
+	expectedGuards := []GuardOutcome{{"cart", "cart-empty", false, nil}, {"cart", "cart-paid", true, nil}}
+	if guards := it.Guards(); !reflect.DeepEqual(guards, expectedGuards) {
+		t.Logf("Guards are different from expected: %v", guards)
+		t.FailNow()
+	}
+
+	expectedActions := []ActionOutcome{
+		{Who: "state entry action", Name: "paid", Written: []string{"visits", "result"}},
+		{Who: "transition action", Name: "cart-paid", Params: map[string]interface{}{"currency": "EUR"}, Written: []string{"receipt"}},
+	}
+	if actions := it.Actions(); !reflect.DeepEqual(actions, expectedActions) {
+		t.Logf("Actions are different from expected: %+v", actions)
+		t.FailNow()
+	}
+}
+
+func TestHistoryItemError(t *testing.T) {
+	fsm := NewFsm(makeCheckoutStructure(true))
+	fsm.SetInput("items", 3)
+	fsm.Run()
+
+	it := fsm.History()[1]
+	actions := it.Actions()
+	if it.Err() == nil || len(actions) != 2 || actions[1].Err == nil || actions[1].Err.Error() != "declined" {
+		t.Logf("Failed step should be recorded: %v, %+v", it.Err(), actions)
+		t.FailNow()
+	}
+}
+
+func TestHistoryItemAttempts(t *testing.T) {
+	failures := 1
+	charge := NewAction(func(ctx ContextOperator) error {
+		if failures > 0 {
+			failures--
+			return errors.New("busy")
+		}
+		return nil
+	}).WithRetry(RetryPolicy{MaxAttempts: 2})
+	refund := NewAction(func(ctx ContextOperator) error { return nil })
+
+	fsm := NewFsm(MakeStructure(nil,
+		NewState("cart", []Transition{NewTransition("cart-paid", "paid", guardAlways, charge).WithCompensation(refund)}),
+		NewState("paid", nil).WithCompensation(refund),
+	), WithClock(&fakeClock{}))
+	fsm.Advance()
+
+	// step is returned by value, its accessors don't need it to be addressable
+	last := func() HistoryItem { step, _ := fsm.Advance(); return step }
+	it := last()
+	if it.From() != "cart" || it.To() != "paid" {
+		t.Logf("Step is different from expected:\n%s", fsm.history.Dump())
+		t.FailNow()
+	}
+
+	attempts := it.Attempts()
+	if len(attempts) != 2 || attempts[0].Err == nil || attempts[1].Err != nil || attempts[1].Number != 2 || attempts[1].Who != "transition action" {
+		t.Logf("Attempts are different from expected: %+v", attempts)
+		t.FailNow()
+	}
+	expected := []PendingCompensation{{State: "paid"}, {State: "cart", Transition: "cart-paid"}}
+	if pending := it.Compensations(); !reflect.DeepEqual(pending, expected) {
+		t.Logf("Compensations are different from expected: %+v", pending)
+		t.FailNow()
+	}
+
+	raw, _ := json.Marshal(it)
+	var decoded map[string]interface{}
+	json.Unmarshal(raw, &decoded)
+	if marshalled, _ := decoded["attempts"].([]interface{}); len(marshalled) != 2 ||
+		marshalled[0].(map[string]interface{})["error"] != "busy" {
+		t.Logf("Marshalled attempts are different from expected: %s", raw)
+		t.FailNow()
+	}
+	if marshalled, _ := decoded["compensations"].([]interface{}); len(marshalled) != 2 ||
+		marshalled[1].(map[string]interface{})["transition"] != "cart-paid" {
+		t.Logf("Marshalled compensations are different from expected: %s", raw)
+		t.FailNow()
+	}
+
+	if fsm.Compensate(); fsm.History()[1].Compensations() != nil {
+		t.Log("Executed compensations should not be pending")
+		t.FailNow()
+	}
+}
+
+func TestHistoryJson(t *testing.T) {
+	fsm := NewFsm(makeCheckoutStructure(true), WithClock(&fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}))
+	fsm.SetInput("items", 3)
+	fsm.Run()
+
+	raw, e := json.Marshal(fsm.History())
+	if e != nil {
+		t.Logf("History should be serializable: %v", e)
+		t.FailNow()
+	}
+	var decoded []map[string]interface{}
+	if e = json.Unmarshal(raw, &decoded); e != nil || len(decoded) != 2 {
+		t.Logf("History should be marshalled as an array: %s", raw)
+		t.FailNow()
+	}
+
+	it := decoded[1]
+	if it["step"] != 1.0 || it["from"] != "cart" || it["to"] != "paid" || it["start"] != "2020-01-01T00:00:00Z" ||
+		it["error"] != "User-defined callback returned an error: transition action, \"declined\"" {
+		t.Logf("Marshalled item is different from expected: %s", raw)
+		t.FailNow()
+	}
+	guards, actions := it["guards"].([]interface{}), it["actions"].([]interface{})
+	if len(guards) != 2 || guards[1].(map[string]interface{})["open"] != true {
+		t.Logf("Marshalled guards are different from expected: %s", raw)
+		t.FailNow()
+	}
+	charge := actions[1].(map[string]interface{})
+	if charge["error"] != "declined" || charge["params"].(map[string]interface{})["currency"] != "EUR" {
+		t.Logf("Marshalled action is different from expected: %s", raw)
+		t.FailNow()
+	}
+}
+
+func TestHistorySnapshot(t *testing.T) {
+	fsm := NewFsm(makeCheckoutStructure(false), WithClock(&tickingClock{tick: time.Second}))
+	fsm.SetInput("items", 3)
+	fsm.Run()
+
+	restored := roundTrip(t, fsm)
+	expected, _ := json.Marshal(fsm.History())
+	actual, _ := json.Marshal(restored.History())
+	if string(expected) != string(actual) {
+		t.Logf("Restored history is different from the original one:\n%s\n%s", expected, actual)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,296 @@
+package simple_fsm
+
+import (
+	"fmt"
+	"sync"
+)
+
+// JournalRecordKind
+// Enum-like type describing journal record meaning
+type JournalRecordKind string
+
+const (
+	// JournalIntent
+	// Transition action is about to be executed
+	JournalIntent JournalRecordKind = "intent"
+	// JournalCommit
+	// Transition action succeeded, record holds context members it has written
+	JournalCommit JournalRecordKind = "commit"
+	// JournalAbort
+	// Transition action failed (or was resolved as not executed)
+	JournalAbort JournalRecordKind = "abort"
+)
+
+// JournalWrite
+// Context member written by an action
+// Empty state means the context of the state active when action was executed
+type JournalWrite struct {
+	State string        `json:"state,omitempty"`
+	Key   string        `json:"key"`
+	Value SnapshotValue `json:"value"`
+}
+
+// JournalRecord
+// Entry of the write-ahead journal, commit and abort records
+// have the same sequence number as the intent they complete
+// Step is an index of the history item transition action belongs to
+type JournalRecord struct {
+	Seq        int               `json:"seq"`
+	Kind       JournalRecordKind `json:"kind"`
+	Step       int               `json:"step"`
+	State      string            `json:"state"`
+	Transition string            `json:"transition"`
+	Writes     []JournalWrite    `json:"writes,omitempty"`
+	Err        string            `json:"error,omitempty"`
+}
+
+// Journal
+// Durable append-only log of transition action executions of FSM instances
+// * Append - durably adds a record to the instance journal
+// * Records - returns instance records in order they were appended
+// * Truncate - discards all records of the instance
+type Journal interface {
+	Append(id string, record JournalRecord) *FsmError
+	Records(id string) ([]JournalRecord, *FsmError)
+	Truncate(id string) *FsmError
+}
+
+// journalBinding
+// Journal FSM logs its actions to, along with instance ID and last sequence number
+type journalBinding struct {
+	journal Journal
+	id      string
+	seq     int
+}
+
+// journalKey
+// Identifies transition action execution within the run
+type journalKey struct {
+	step       int
+	state      string
+	transition string
+}
+
+// WithJournal
+// Makes FSM log an intent before executing every transition action
+// and a commit (with context members written) or an abort after it
+// Journal is truncated every time FSM is saved to the store (see WithStore),
+// so it only covers the step FSM is making (see RecoverFsm)
+// FSM should be bound to a store as well, otherwise it refuses to make steps
+func WithJournal(journal Journal, id string) FsmOption {
+	return func(fsm *Fsm) {
+		fsm.journal = &journalBinding{journal: journal, id: id}
+	}
+}
+
+// RecoverFsm
+// Loads FSM instance from the store (see LoadFsm) and replays its journal:
+// actions committed during the step that wasn't saved are not executed again
+// when the step is repeated, their context writes are applied instead.
+// Actions having an intent only are in doubt: their side effects might
+// or might not have happened, FSM won't make steps until they're resolved (see Resolve)
+func RecoverFsm(store Store, journal Journal, id string, structure *Structure, options ...FsmOption) (fsm *Fsm, err *FsmError) {
+	if fsm, err = LoadFsm(store, id, structure, append(options, WithJournal(journal, id))...); err != nil {
+		return
+	}
+
+	records, err := journal.Records(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var intents []JournalRecord
+	outcomes := make(map[int]JournalRecord)
+	for _, rec := range records {
+		if rec.Seq > fsm.journal.seq {
+			fsm.journal.seq = rec.Seq
+		}
+		if rec.Step < len(fsm.history) {
+			// the step is already saved
+			continue
+		}
+		if rec.Kind == JournalIntent {
+			intents = append(intents, rec)
+		} else {
+			outcomes[rec.Seq] = rec
+		}
+	}
+
+	fsm.replay = make(map[journalKey][]contextWrite)
+	for _, intent := range intents {
+		outcome, done := outcomes[intent.Seq]
+		switch {
+		case !done:
+			fsm.inDoubt = append(fsm.inDoubt, intent)
+		case outcome.Kind == JournalCommit:
+			var writes []contextWrite
+			if writes, err = fsm.decodeWrites(outcome.Writes); err != nil {
+				return nil, err
+			}
+			fsm.replay[journalKey{intent.Step, intent.State, intent.Transition}] = writes
+		}
+	}
+	return
+}
+
+// InDoubt
+// Returns intents of actions which outcome is unknown after recovery
+func (fsm *Fsm) InDoubt() []JournalRecord {
+	return fsm.inDoubt
+}
+
+// Resolve
+// Settles outcome of in-doubt action given its sequence number
+// Executed action is not repeated, given members are put to the context
+// it would be executed with. Action that wasn't executed is repeated.
+// Resolution is journaled, so it survives another recovery
+func (fsm *Fsm) Resolve(seq int, executed bool, writes map[string]interface{}) *FsmError {
+	pos := -1
+	for idx, rec := range fsm.inDoubt {
+		if rec.Seq == seq {
+			pos = idx
+		}
+	}
+	if pos < 0 {
+		return newFsmErrorWrongFlow(fmt.Sprintf("resolve action #%d", seq), "not in doubt about it")
+	}
+
+	intent := fsm.inDoubt[pos]
+	outcome := intent
+	outcome.Kind = JournalAbort
+	var recorded []contextWrite
+	if executed {
+		outcome.Kind = JournalCommit
+		for k, v := range writes {
+			recorded = append(recorded, contextWrite{key: k, value: v})
+		}
+		var err *FsmError
+		if outcome.Writes, err = fsm.encodeWrites(recorded); err != nil {
+			return err
+		}
+	}
+	if err := fsm.journal.journal.Append(fsm.journal.id, outcome); err != nil {
+		return err
+	}
+
+	if executed {
+		if fsm.replay == nil {
+			fsm.replay = make(map[journalKey][]contextWrite)
+		}
+		fsm.replay[journalKey{intent.Step, intent.State, intent.Transition}] = recorded
+	}
+	fsm.inDoubt = append(fsm.inDoubt[:pos], fsm.inDoubt[pos+1:]...)
+	return nil
+}
+
+// doTransitionAction
+// Executes transition action, logging it to the journal (if any)
+// Action committed before recovery is not executed, its writes are repeated instead
+func (fsm *Fsm) doTransitionAction(stack *ContextStack, tr *stackTransition) error {
+	if fsm.journal == nil {
+		return fsm.doAction(stack, "transition action", tr.Name, tr.Action)
+	}
+
+	// actions run before the step is logged (by choice pseudo-states) belong to it as well
+	key := journalKey{fsm.stepIdx, tr.source.Name, tr.Name}
+	if writes, replayed := fsm.replay[key]; replayed {
+		delete(fsm.replay, key)
+		if err := applyWrites(stack, writes); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	fsm.journal.seq++
+	intent := JournalRecord{
+		Seq:        fsm.journal.seq,
+		Kind:       JournalIntent,
+		Step:       key.step,
+		State:      key.state,
+		Transition: key.transition,
+	}
+	if err := fsm.journal.journal.Append(fsm.journal.id, intent); err != nil {
+		return err
+	}
+
+	recorder := newContextRecorder(stack)
+	e := fsm.doAction(recorder, "transition action", tr.Name, tr.Action)
+
+	outcome := intent
+	if e != nil {
+		outcome.Kind, outcome.Err = JournalAbort, e.Error()
+	} else {
+		outcome.Kind = JournalCommit
+		var err *FsmError
+		if outcome.Writes, err = fsm.encodeWrites(recorder.writes); err != nil {
+			// no commit record, so the action stays in doubt
+			return err
+		}
+	}
+	if err := fsm.journal.journal.Append(fsm.journal.id, outcome); err != nil && e == nil {
+		return err
+	}
+	return e
+}
+
+// encodeWrites
+// Converts context writes to journal representation
+func (fsm *Fsm) encodeWrites(writes []contextWrite) (encoded []JournalWrite, err *FsmError) {
+	for _, w := range writes {
+		var value SnapshotValue
+		if value, err = fsm.codecs.encode(w.key, w.value); err != nil {
+			return
+		}
+		encoded = append(encoded, JournalWrite{State: w.state, Key: w.key, Value: value})
+	}
+	return
+}
+
+// decodeWrites
+// Converts journaled writes back to context writes
+func (fsm *Fsm) decodeWrites(encoded []JournalWrite) (writes []contextWrite, err *FsmError) {
+	for _, w := range encoded {
+		var value interface{}
+		if value, err = fsm.codecs.decode(w.Key, w.Value); err != nil {
+			return
+		}
+		writes = append(writes, contextWrite{w.State, w.Key, value})
+	}
+	return
+}
+
+// MemoryJournal
+// Journal keeping records in memory, goroutine-safe
+type MemoryJournal struct {
+	mu      sync.Mutex
+	records map[string][]JournalRecord
+}
+
+// NewMemoryJournal
+// Constructs empty in-memory journal
+func NewMemoryJournal() *MemoryJournal {
+	return &MemoryJournal{records: make(map[string][]JournalRecord)}
+}
+
+// Journal.Append
+func (mj *MemoryJournal) Append(id string, record JournalRecord) *FsmError {
+	mj.mu.Lock()
+	defer mj.mu.Unlock()
+	mj.records[id] = append(mj.records[id], record)
+	return nil
+}
+
+// Journal.Records
+func (mj *MemoryJournal) Records(id string) ([]JournalRecord, *FsmError) {
+	mj.mu.Lock()
+	defer mj.mu.Unlock()
+	return append([]JournalRecord(nil), mj.records[id]...), nil
+}
+
+// Journal.Truncate
+func (mj *MemoryJournal) Truncate(id string) *FsmError {
+	mj.mu.Lock()
+	defer mj.mu.Unlock()
+	delete(mj.records, id)
+	return nil
+}
@@ -0,0 +1,179 @@
+package simple_fsm
+
+import (
+	"errors"
+	"testing"
+)
+
+// crashingStore
+// Store failing to save, as if the process crashed before saving
+type crashingStore struct {
+	Store
+	crash bool
+}
+
+func (cs *crashingStore) Save(id string, snapshot *Snapshot, expected int) (int, *FsmError) {
+	if cs.crash {
+		return 0, newStoreErrorFailed(id, errors.New("crash"))
+	}
+	return cs.Store.Save(id, snapshot, expected)
+}
+
+// crashingJournal
+// Journal failing to log action outcomes, as if the process crashed during an action
+type crashingJournal struct {
+	Journal
+	crash bool
+}
+
+func (cj *crashingJournal) Append(id string, record JournalRecord) *FsmError {
+	if cj.crash && record.Kind != JournalIntent {
+		return newStoreErrorFailed(id, errors.New("crash"))
+	}
+	return cj.Journal.Append(id, record)
+}
+
+// crashOnCharge
+// Runs order FSM until it crashes while charging the card
+func crashOnCharge(t *testing.T, store *crashingStore, journal *crashingJournal, charges *int) {
+	fsm := NewFsm(makeOrderStructure(charges), WithStore(store, "order"), WithJournal(journal, "order"))
+	if _, err := fsm.Advance(); err != nil {
+		t.Logf("First step should be saved: %v", err)
+		t.FailNow()
+	}
+	store.crash = true
+	fsm.Advance()
+	store.crash, journal.crash = false, false
+}
+
+func TestFsmRecoverCommitted(t *testing.T) {
+	charges := 0
+	store := &crashingStore{Store: NewMemoryStore()}
+	journal := &crashingJournal{Journal: NewMemoryJournal()}
+	crashOnCharge(t, store, journal, &charges)
+
+	fsm, err := RecoverFsm(store, journal, "order", makeOrderStructure(&charges))
+	if err != nil || len(fsm.InDoubt()) != 0 || fsm.stack.Peek().state.Name != "new" {
+		t.Logf("FSM should be recovered from the last snapshot: %v", err)
+		t.FailNow()
+	}
+	if _, err = fsm.Advance(); err != nil || charges != 1 {
+		t.Logf("Committed action should not be executed again, charges: %d, error: %v", charges, err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+	if receipt, err := fsm.stack.ByState("charged").context.Int("receipt"); err != nil || receipt != 1 {
+		t.Log("Replayed writes should go to the same contexts")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+	if records, _ := journal.Records("order"); len(records) != 0 {
+		t.Logf("Journal should be truncated once FSM is saved: %v", records)
+		t.FailNow()
+	}
+}
+
+func TestFsmJournalWithoutStore(t *testing.T) {
+	charges := 0
+	journal := NewMemoryJournal()
+	fsm := NewFsm(makeOrderStructure(&charges), WithJournal(journal, "order"))
+	if _, err := fsm.Advance(); err == nil || err.Kind() != ErrFsmWrongFlow || fsm.Fatal() {
+		t.Logf("Journaled FSM should not make steps without a store: %v", err)
+		t.FailNow()
+	}
+	if records, _ := journal.Records("order"); len(records) != 0 || charges != 0 {
+		t.Logf("Nothing should be journaled: %v", records)
+		t.FailNow()
+	}
+}
+
+func TestFsmRecoverChoice(t *testing.T) {
+	for _, inDoubt := range []bool{false, true} {
+		charges := 0
+		store := &crashingStore{Store: NewMemoryStore()}
+		journal := &crashingJournal{Journal: NewMemoryJournal()}
+		fsm := NewFsm(makeChoiceOrderStructure(&charges), WithStore(store, "order"), WithJournal(journal, "order"))
+		if _, err := fsm.Advance(); err != nil {
+			t.Logf("First step should be saved: %v", err)
+			t.FailNow()
+		}
+		store.crash, journal.crash = true, inDoubt
+		fsm.Advance()
+		store.crash, journal.crash = false, false
+
+		recovered, err := RecoverFsm(store, journal, "order", makeChoiceOrderStructure(&charges))
+		if err != nil {
+			t.Logf("FSM should be recovered: %v", err)
+			t.FailNow()
+		}
+		if inDoubt {
+			if len(recovered.InDoubt()) != 1 || recovered.InDoubt()[0].Transition != "new-choice" {
+				t.Logf("Action run on the way through choice should be in doubt: %v", recovered.InDoubt())
+				t.FailNow()
+			}
+			continue
+		}
+		if _, err = recovered.Advance(); err != nil || charges != 1 {
+			t.Logf("Action run on the way through choice should not be repeated, charges: %d, error: %v", charges, err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestFsmRecoverInDoubt(t *testing.T) {
+	charges := 0
+	store := &crashingStore{Store: NewMemoryStore()}
+	journal := &crashingJournal{Journal: NewMemoryJournal()}
+	journal.crash = true
+	crashOnCharge(t, store, journal, &charges)
+
+	fsm, err := RecoverFsm(store, journal, "order", makeOrderStructure(&charges))
+	if err != nil || len(fsm.InDoubt()) != 1 || fsm.InDoubt()[0].Transition != "new-charged" {
+		t.Logf("Action without outcome should be in doubt: %v", err)
+		t.FailNow()
+	}
+	if _, err = fsm.Advance(); err == nil || err.Kind() != ErrFsmInDoubt || fsm.Fatal() {
+		t.Logf("FSM should not proceed until in-doubt action is resolved: %v", err)
+		t.FailNow()
+	}
+	if err = fsm.Resolve(42, true, nil); err == nil {
+		t.Log("Unknown action should not be resolved")
+		t.FailNow()
+	}
+	if err = fsm.Resolve(fsm.InDoubt()[0].Seq, true, map[string]interface{}{"receipt": 1}); err != nil {
+		t.Logf("In-doubt action should be resolved: %v", err)
+		t.FailNow()
+	}
+
+	// resolution is journaled
+	again, err := RecoverFsm(store, journal, "order", makeOrderStructure(&charges))
+	if err != nil || len(again.InDoubt()) != 0 {
+		t.Logf("Resolution should survive recovery: %v", again.InDoubt())
+		t.FailNow()
+	}
+
+	if _, err = fsm.Advance(); err != nil || charges != 1 {
+		t.Logf("Executed action should not be repeated, charges: %d, error: %v", charges, err)
+		t.FailNow()
+	}
+	if receipt, err := fsm.stack.Int("receipt"); err != nil || receipt != 1 {
+		t.Log("Resolution members should be put to the context")
+		t.FailNow()
+	}
+}
+
+func TestFsmRecoverNotExecuted(t *testing.T) {
+	charges := 0
+	store := &crashingStore{Store: NewMemoryStore()}
+	journal := &crashingJournal{Journal: NewMemoryJournal()}
+	journal.crash = true
+	crashOnCharge(t, store, journal, &charges)
+
+	fsm, _ := RecoverFsm(store, journal, "order", makeOrderStructure(&charges))
+	charges = 0
+	fsm.Resolve(fsm.InDoubt()[0].Seq, false, nil)
+	if fsm.Run(); !fsm.Completed() || charges != 1 {
+		t.Logf("Action that wasn't executed should be repeated, charges: %d", charges)
+		t.FailNow()
+	}
+}
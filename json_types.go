@@ -1,7 +1,11 @@
 package simple_fsm
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"time"
 )
 
 type JsonGuard struct {
@@ -53,9 +57,50 @@ func (jg *JsonGuard) GuardFn() (guard GuardFn, err *FsmError) {
 	return
 }
 
+type JsonRetry struct {
+	Attempts int      `json:"attempts"`
+	Backoff  string   `json:"backoff"`
+	Delay    string   `json:"delay"`
+	MaxDelay string   `json:"maxdelay"`
+	On       []string `json:"on"`
+}
+
+func (jr *JsonRetry) RetryPolicy() (rp RetryPolicy, err *FsmError) {
+	rp.MaxAttempts = jr.Attempts
+	rp.On = jr.On
+
+	switch jr.Backoff {
+	case "", "fixed":
+		rp.Backoff = BackoffFixed
+	case "exponential":
+		rp.Backoff = BackoffExponential
+	default:
+		err = newFsmErrorInvalid(fmt.Sprintf("unknown retry backoff \"%s\"", jr.Backoff))
+		return
+	}
+
+	for _, d := range []struct {
+		raw string
+		dst *time.Duration
+	}{{jr.Delay, &rp.Delay}, {jr.MaxDelay, &rp.MaxDelay}} {
+		if len(d.raw) == 0 {
+			continue
+		}
+		var e error
+		if *d.dst, e = time.ParseDuration(d.raw); e != nil {
+			err = newFsmErrorInvalid(fmt.Sprintf("invalid retry delay \"%s\": %s", d.raw, e.Error()))
+			return
+		}
+	}
+
+	err = rp.Validate()
+	return
+}
+
 type JsonAction struct {
 	Name   string                 `json:"name"`
 	Params map[string]interface{} `json:"params"`
+	Retry  *JsonRetry             `json:"retry"`
 }
 
 func (ja *JsonAction) PackagedAction(actions ActionMap) (pa *PackagedAction, err *FsmError) {
@@ -76,13 +121,26 @@ func (ja *JsonAction) PackagedAction(actions ActionMap) (pa *PackagedAction, err
 			pa.Param(k, v)
 		}
 	}
+	if ja.Retry != nil {
+		var policy RetryPolicy
+		if policy, err = ja.Retry.RetryPolicy(); err != nil {
+			return
+		}
+		pa.WithRetry(policy)
+	}
 	return
 }
 
 type JsonTransition struct {
-	ToState string     `bson:"to" json:"to"`
-	Guard   JsonGuard  `json:"guard"`
-	Action  JsonAction `json:"action"`
+	Name       string     `json:"name"`
+	ToState    string     `bson:"to" json:"to"`
+	Event      string     `bson:"on" json:"on"`
+	Priority   int        `json:"priority"`
+	Kind       string     `json:"kind"`
+	Else       bool       `json:"else"`
+	Guard      JsonGuard  `json:"guard"`
+	Action     JsonAction `json:"action"`
+	Compensate JsonAction `json:"compensate"`
 }
 
 func (jt *JsonTransition) Transition(name string, actions ActionMap) (tr Transition, err *FsmError) {
@@ -91,42 +149,182 @@ func (jt *JsonTransition) Transition(name string, actions ActionMap) (tr Transit
 		return
 	}
 
+	var compensation *PackagedAction
+	if compensation, err = jt.Compensate.PackagedAction(actions); err != nil {
+		return
+	}
+
 	var guard GuardFn
 	if guard, err = jt.Guard.GuardFn(); err != nil {
 		return
 	}
 
-	tr = NewTransition(name, jt.ToState, guard, action)
+	if len(jt.Event) > 0 {
+		tr = NewEventTransition(name, jt.Event, jt.ToState, guard, action)
+	} else {
+		tr = NewTransition(name, jt.ToState, guard, action)
+	}
+	tr.Priority = jt.Priority
+	tr.Else = jt.Else
+	tr.Compensation = compensation
+
+	switch jt.Kind {
+	case "", "external":
+	case "internal":
+		tr.Kind = TransitionInternal
+	default:
+		err = newFsmErrorInvalid(fmt.Sprintf("unknown kind \"%s\" of transition \"%s\"", jt.Kind, name))
+	}
 	return
 }
 
-type JsonState struct {
-	Start         bool                      `json:"start"`
-	StartSubState string                    `json:"startsub"`
-	Parent        string                    `json:"parent"`
-	Transitions   map[string]JsonTransition `json:"transitions"`
-}
+// JsonTransitions
+// Ordered transition list, can be unmarshalled either from an object
+// (keys are used as transition names, document order is preserved)
+// or from an array (names are taken from "name" members)
+// Like encoding/json itself, type mismatches don't stop unmarshalling,
+// the first one is reported when the whole list is processed
+type JsonTransitions []JsonTransition
 
-func (js JsonState) StateInfo(name string, parent *StateInfo, actions ActionMap) (si *StateInfo, err *FsmError) {
-	var start bool
-	if len(js.StartSubState) > 0 {
-		if len(js.Transitions) > 0 {
-			err = newFsmErrorInvalid("State w/ start sub state can't have custom transitions")
-			return
+func (jts *JsonTransitions) UnmarshalJSON(raw []byte) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '[' {
+		var list []JsonTransition
+		err := json.Unmarshal(raw, &list)
+		if _, mismatch := err.(*json.UnmarshalTypeError); err == nil || mismatch {
+			*jts = list
 		}
-		trName := fmt.Sprintf("Always %s->%s", name, js.StartSubState)
-		si = NewState(name, NewTransitionAlways(trName, js.StartSubState, nil))
-		start = true
-	} else {
-		trs := make([]Transition, 0, len(js.Transitions))
-		for trName, jtr := range js.Transitions {
-			var tr Transition
-			if tr, err = jtr.Transition(trName, actions); err != nil {
-				return
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		return nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("transitions should be either an object or an array, got %v", tok)
+	}
+
+	var mismatch error
+	list := make([]JsonTransition, 0)
+	for dec.More() {
+		if tok, err = dec.Token(); err != nil {
+			return err
+		}
+		var jt JsonTransition
+		if err = dec.Decode(&jt); err != nil {
+			if _, ok := err.(*json.UnmarshalTypeError); !ok {
+				return err
+			}
+			if mismatch == nil {
+				mismatch = err
 			}
-			trs = append(trs, tr)
 		}
-		si = NewState(name, trs)
+		jt.Name = tok.(string)
+		list = append(list, jt)
+	}
+	*jts = list
+	return mismatch
+}
+
+// transitions
+// Constructs transitions in list order
+func (jts JsonTransitions) transitions(actions ActionMap) (trs []Transition, err *FsmError) {
+	trs = make([]Transition, 0, len(jts))
+	for _, jtr := range jts {
+		var tr Transition
+		if tr, err = jtr.Transition(jtr.Name, actions); err != nil {
+			return
+		}
+		trs = append(trs, tr)
+	}
+	return
+}
+
+type JsonRegion struct {
+	StartSubState string     `json:"startsub"`
+	OnEnter       JsonAction `json:"onenter"`
+	OnExit        JsonAction `json:"onexit"`
+}
+
+type JsonState struct {
+	Start         bool                  `json:"start"`
+	StartSubState string                `json:"startsub"`
+	Parent        string                `json:"parent"`
+	Regions       map[string]JsonRegion `json:"regions"`
+	Transitions   JsonTransitions       `json:"transitions"`
+	Done          JsonTransitions       `json:"ondone"`
+	OnError       JsonTransitions       `json:"onerror"`
+	OnEnter       JsonAction            `json:"onenter"`
+	OnExit        JsonAction            `json:"onexit"`
+	Compensate    JsonAction            `json:"compensate"`
+	History       string                `json:"history"`
+	HistoryCtx    bool                  `json:"historycontext"`
+	Pseudo        string                `json:"pseudo"`
+
+	// filled in while building state hierarchy
+	startSub bool // state is a start sub state of its parent
+	region   bool // state is a region of its (parallel) parent
+}
+
+// regionNames
+// Returns names of state regions in lexical order, regions are added to the state in that order
+func (js JsonState) regionNames() []string {
+	names := make([]string, 0, len(js.Regions))
+	for name := range js.Regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (js JsonState) StateInfo(name string, parent *StateInfo, actions ActionMap) (si *StateInfo, err *FsmError) {
+	var trs []Transition
+	if trs, err = js.Transitions.transitions(actions); err != nil {
+		return
+	}
+	si = NewState(name, trs)
+
+	if si.Done, err = js.Done.transitions(actions); err != nil {
+		return
+	}
+	if si.OnError, err = js.OnError.transitions(actions); err != nil {
+		return
+	}
+	if si.OnEnter, err = js.OnEnter.PackagedAction(actions); err != nil {
+		return
+	}
+	if si.OnExit, err = js.OnExit.PackagedAction(actions); err != nil {
+		return
+	}
+	if si.Compensation, err = js.Compensate.PackagedAction(actions); err != nil {
+		return
+	}
+
+	switch js.Pseudo {
+	case "":
+	case "choice":
+		si.Pseudo = PseudoChoice
+	case "junction":
+		si.Pseudo = PseudoJunction
+	default:
+		err = newFsmErrorInvalid(fmt.Sprintf("unknown pseudo-state kind \"%s\"", js.Pseudo))
+		return
+	}
+
+	switch js.History {
+	case "":
+	case "shallow":
+		si.Remember(HistoryShallow, js.HistoryCtx)
+	case "deep":
+		si.Remember(HistoryDeep, js.HistoryCtx)
+	default:
+		err = newFsmErrorInvalid(fmt.Sprintf("unknown history kind \"%s\"", js.History))
+		return
 	}
 
 	if len(js.Parent) > 0 {
@@ -140,7 +338,11 @@ func (js JsonState) StateInfo(name string, parent *StateInfo, actions ActionMap)
 			return
 		}
 
-		parent.addSubState(si, start)
+		if js.region {
+			err = parent.addRegion(si)
+		} else {
+			err = parent.addSubState(si, js.startSub)
+		}
 	}
 
 	return
@@ -3,6 +3,7 @@ package simple_fsm
 import (
 	"encoding/json"
 	"testing"
+	"time"
 )
 
 func TestJsonGuardUnmarshal(t *testing.T) {
@@ -123,8 +124,78 @@ func TestJsonTransitionUnmarshal(t *testing.T) {
 
 }
 
+func TestJsonTransitionEvent(t *testing.T) {
+	rawJson := `
+    {
+        "to": "2",
+        "on": "approve"
+    }`
+	var jt JsonTransition
+	if err := json.Unmarshal([]byte(rawJson), &jt); err != nil {
+		t.Logf("Unmarshalling failed: %s", err.Error())
+		t.FailNow()
+	}
+	tr, err := jt.Transition("1-2", ActionMap{})
+	if err != nil {
+		t.Logf("Expected to pass, error: %s", err.Error())
+		t.FailNow()
+	}
+	if tr.Event != "approve" || tr.Guard == nil {
+		t.Logf("Transition is different from expected: %v", tr)
+		t.FailNow()
+	}
+}
+
+func TestJsonTransitionsUnmarshal(t *testing.T) {
+	rawJson := `
+	{
+		"transitions": {
+			"b": {"to": "2"},
+			"a": {"to": "3", "priority": 2},
+			"c": {"to": "4"}
+		}
+	}`
+	var js JsonState
+	if err := json.Unmarshal([]byte(rawJson), &js); err != nil {
+		t.Logf("Unmarshalling failed: %s", err.Error())
+		t.FailNow()
+	}
+	if len(js.Transitions) != 3 || js.Transitions[0].Name != "b" ||
+		js.Transitions[1].Name != "a" || js.Transitions[1].Priority != 2 || js.Transitions[2].Name != "c" {
+		t.Logf("Transitions are different from expected (document order): %v", js.Transitions)
+		t.FailNow()
+	}
+
+	rawJson = `
+	{
+		"transitions": [
+			{"name": "z", "to": "2"},
+			{"name": "y", "to": "3", "on": "go"}
+		]
+	}`
+	js = JsonState{}
+	if err := json.Unmarshal([]byte(rawJson), &js); err != nil {
+		t.Logf("Unmarshalling failed: %s", err.Error())
+		t.FailNow()
+	}
+	si, err := js.StateInfo("1", nil, ActionMap{})
+	if err != nil {
+		t.Logf("Constructing state info failed: %s", err.Error())
+		t.FailNow()
+	}
+	if len(si.Transitions) != 2 || si.Transitions[0].Name != "z" || si.Transitions[1].Event != "go" {
+		t.Logf("Transitions are different from expected (array order): %v", si.Transitions)
+		t.FailNow()
+	}
+
+	if err := json.Unmarshal([]byte(`{"transitions": 42}`), &js); err == nil {
+		t.Log("Unmarshalling should fail (transitions are neither an object nor an array)")
+		t.FailNow()
+	}
+}
+
 func TestJsonTransitionFn(t *testing.T) {
-	jt := JsonTransition{"2", JsonGuard{"always", "", nil}, JsonAction{"hello", nil}}
+	jt := JsonTransition{ToState: "2", Guard: JsonGuard{"always", "", nil}, Action: JsonAction{Name: "hello"}}
 	act := make(ActionMap)
 	if _, err := jt.Transition("1-2", act); err == nil || err.Kind() != ErrFsmIsInvalid {
 		t.Log("Expected to fail (no action found)")
@@ -202,12 +273,32 @@ func TestJsonStartStateInfoValid(t *testing.T) {
 		t.Logf("Constructing state info failed: %s", err.Error())
 		t.FailNow()
 	}
-	if si.Name != "11" || si.Parent.Name != "1" || si.Transitions[0].ToState != "111" {
+	// start sub state is linked when sub state itself is constructed
+	if si.Name != "11" || si.Parent.Name != "1" || len(si.Transitions) != 0 {
 		t.Logf("StateInfo object is different from expected")
 		t.FailNow()
 	}
 }
 
+func TestJsonStartStateInfoTransitions(t *testing.T) {
+	rawJson := `
+	{
+		"startsub": "111",
+		"transitions": {
+			"11-cancelled": {"to": "cancelled", "on": "cancel"}
+		}
+	}`
+
+	var js JsonState
+	json.Unmarshal([]byte(rawJson), &js)
+
+	si, err := js.StateInfo("11", nil, ActionMap{})
+	if err != nil || len(si.Transitions) != 1 || si.Transitions[0].Event != "cancel" {
+		t.Logf("Composite state should keep its own transitions, error: %v", err)
+		t.FailNow()
+	}
+}
+
 func TestJsonSubStateInfoValid(t *testing.T) {
 	rawJson := `
 	{
@@ -245,6 +336,40 @@ func TestJsonSubStateInfoValid(t *testing.T) {
 	}
 }
 
+func TestJsonStateInfoEntryExit(t *testing.T) {
+	rawJson := `
+	{
+		"onenter": {
+			"name": "prepare",
+			"params": {
+				"what": "world"
+			}
+		},
+		"onexit": {
+			"name": "cleanup"
+		}
+	}`
+
+	var js JsonState
+	json.Unmarshal([]byte(rawJson), &js)
+
+	noop := func(ctx ContextOperator) error { return nil }
+	if _, err := js.StateInfo("1", nil, ActionMap{"prepare": noop}); err == nil || err.Kind() != ErrFsmIsInvalid {
+		t.Log("StateInfo() should fail (exit action is not in the map)")
+		t.FailNow()
+	}
+
+	si, err := js.StateInfo("1", nil, ActionMap{"prepare": noop, "cleanup": noop})
+	if err != nil {
+		t.Logf("Constructing state info failed: %s", err.Error())
+		t.FailNow()
+	}
+	if si.OnEnter == nil || si.OnEnter.Params["what"] != "world" || si.OnExit == nil {
+		t.Logf("Entry/exit actions are different from expected: %v, %v", si.OnEnter, si.OnExit)
+		t.FailNow()
+	}
+}
+
 func TestJsonStateInfoInvalidParameters(t *testing.T) {
 	rawJson := `
 	{
@@ -276,28 +401,111 @@ func TestJsonStateInfoInvalidParameters(t *testing.T) {
 	}
 }
 
-func TestJsonStateInfoIllFormed(t *testing.T) {
+func TestJsonStateInfoHistory(t *testing.T) {
+	var js JsonState
+	json.Unmarshal([]byte(`{"history": "deep", "historycontext": true}`), &js)
+	si, err := js.StateInfo("1", nil, ActionMap{})
+	if err != nil || si.HistoryKind != HistoryDeep || !si.HistoryContext {
+		t.Logf("History settings are different from expected, error: %v", err)
+		t.FailNow()
+	}
+
+	json.Unmarshal([]byte(`{"history": "sometimes"}`), &js)
+	if _, err := js.StateInfo("1", nil, ActionMap{}); err == nil || err.Kind() != ErrFsmIsInvalid {
+		t.Log("StateInfo() should fail (unknown history kind)")
+		t.FailNow()
+	}
+}
+
+func TestJsonTransitionKind(t *testing.T) {
+	var jt JsonTransition
+	json.Unmarshal([]byte(`{"to": "1", "kind": "internal"}`), &jt)
+	if tr, err := jt.Transition("1-1", ActionMap{}); err != nil || tr.Kind != TransitionInternal {
+		t.Logf("Transition should be internal, error: %v", err)
+		t.FailNow()
+	}
+
+	json.Unmarshal([]byte(`{"to": "1", "kind": "sideways"}`), &jt)
+	if _, err := jt.Transition("1-1", ActionMap{}); err == nil || err.Kind() != ErrFsmIsInvalid {
+		t.Log("Transition() should fail (unknown kind)")
+		t.FailNow()
+	}
+}
+
+func TestJsonStateInfoPseudo(t *testing.T) {
 	rawJson := `
 	{
-		"startsub": "1",
-		"transitions": {
-			"11-12": {
-				"to": "12",
-				"guard": {
-					"type": "always"
-				},
-				"action": "setnext"
-			}
-		}
+		"pseudo": "junction",
+		"transitions": [
+			{"name": "1-2", "to": "2", "guard": {"type": "context", "key": "next", "value": 2}},
+			{"name": "1-3", "to": "3", "else": true}
+		]
 	}`
 
 	var js JsonState
 	json.Unmarshal([]byte(rawJson), &js)
+	si, err := js.StateInfo("1", nil, ActionMap{})
+	if err != nil || si.Pseudo != PseudoJunction || !si.Transitions[1].Else || si.Validate() != nil {
+		t.Logf("Pseudo-state is different from expected, error: %v", err)
+		t.FailNow()
+	}
 
-	act := ActionMap{"setnext": func(ctx ContextOperator) error { return nil }}
-	if _, err := js.StateInfo("11", nil, act); err == nil || err.Kind() != ErrFsmIsInvalid {
-		t.Logf("StateInfo() should fail (state w/ start sub can't have costom transitions): %s",
-			err.Error())
+	json.Unmarshal([]byte(`{"pseudo": "fork"}`), &js)
+	if _, err := js.StateInfo("1", nil, ActionMap{}); err == nil || err.Kind() != ErrFsmIsInvalid {
+		t.Log("StateInfo() should fail (unknown pseudo-state kind)")
+		t.FailNow()
+	}
+}
+
+func TestJsonStateInfoOnError(t *testing.T) {
+	var js JsonState
+	json.Unmarshal([]byte(`{"onerror": {"1-failed": {"to": "failed"}}}`), &js)
+	si, err := js.StateInfo("1", nil, ActionMap{})
+	if err != nil || len(si.OnError) != 1 || si.OnError[0].ToState != "failed" || !si.Final() {
+		t.Logf("Error transitions are different from expected, error: %v", err)
+		t.FailNow()
+	}
+}
+
+func TestJsonActionRetry(t *testing.T) {
+	var ja JsonAction
+	json.Unmarshal([]byte(`{"name": "act", "retry": {"attempts": 3, "backoff": "exponential", "delay": "100ms", "on": ["busy"]}}`), &ja)
+	pa, err := ja.PackagedAction(ActionMap{"act": func(ctx ContextOperator) error { return nil }})
+	if err != nil || pa.Retry == nil || pa.Retry.MaxAttempts != 3 || pa.Retry.Backoff != BackoffExponential ||
+		pa.Retry.Delay != 100*time.Millisecond || len(pa.Retry.On) != 1 {
+		t.Logf("Retry policy is different from expected, error: %v", err)
+		t.FailNow()
+	}
+
+	for _, raw := range []string{
+		`{"name": "act", "retry": {"attempts": 0}}`,
+		`{"name": "act", "retry": {"attempts": 1, "backoff": "linear"}}`,
+		`{"name": "act", "retry": {"attempts": 1, "delay": "soon"}}`,
+	} {
+		ja = JsonAction{}
+		json.Unmarshal([]byte(raw), &ja)
+		if _, err := ja.PackagedAction(ActionMap{"act": func(ctx ContextOperator) error { return nil }}); err == nil {
+			t.Logf("PackagedAction() should fail (invalid retry policy): %s", raw)
+			t.FailNow()
+		}
+	}
+}
+
+func TestJsonCompensate(t *testing.T) {
+	actions := ActionMap{"undo": func(ctx ContextOperator) error { return nil }}
+
+	var js JsonState
+	json.Unmarshal([]byte(`{"compensate": {"name": "undo"}, "transitions": {"t": {"to": "x", "compensate": {"name": "undo"}}}}`), &js)
+	si, err := js.StateInfo("s", nil, actions)
+	if err != nil || si.Compensation == nil || si.Transitions[0].Compensation == nil {
+		t.Logf("State and transition compensations should be set, error: %v", err)
+		t.FailNow()
+	}
+
+	var jt JsonTransition
+	json.Unmarshal([]byte(`{"to": "x", "compensate": {"name": "missing"}}`), &jt)
+	if _, err := jt.Transition("t", actions); err == nil {
+		t.Log("Transition() should fail (unknown compensation action)")
 		t.FailNow()
 	}
 }
@@ -0,0 +1,160 @@
+package simple_fsm
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// FsmLimits
+// Runtime limits protecting FSM from infinite transition loops
+// Zero values mean "no limit"
+// * MaxSteps - total number of transitions made since reset (steps of parallel regions are counted one by one)
+// * MaxStateVisits - number of times any single state can be entered
+// * DetectCycles - stop if the same state is reached with the same contexts again
+// Only the state a step ends in (the innermost active one, see HistoryItem.To) counts as visited,
+// composite states entered on the way don't, so a loop through a composite state is caught by its sub state visits
+// Fired events are external input, so they reset cycle detection
+// Budgets are checked before the step is made, the one exceeding them is not taken at all
+// (except for visits of the state behind a choice pseudo-state: it's known only once
+// the choice is reached, that is after active states are exited and transition actions are executed)
+type FsmLimits struct {
+	MaxSteps       int
+	MaxStateVisits int
+	DetectCycles   bool
+}
+
+// WithLimits
+// Enables infinite loop detection and step budgets (see FsmLimits)
+func WithLimits(limits FsmLimits) FsmOption {
+	return func(fsm *Fsm) {
+		fsm.loops.limits = limits
+	}
+}
+
+// loopGuard
+// Keeps track of FSM progress and checks it against limits
+type loopGuard struct {
+	limits    FsmLimits
+	steps     int
+	visits    map[string]int
+	lastVisit map[string]int
+	seen      map[uint64]int
+}
+
+// newLoopGuard
+// Constructs loop guard with given limits
+func newLoopGuard(limits FsmLimits) loopGuard {
+	lg := loopGuard{limits: limits}
+	lg.reset()
+	return lg
+}
+
+// reset
+// Forgets all progress, limits are kept
+func (lg *loopGuard) reset() {
+	lg.steps = 0
+	lg.visits = make(map[string]int)
+	lg.lastVisit = make(map[string]int)
+	lg.forget()
+}
+
+// forget
+// Discards configurations seen so far, so they won't be treated as a cycle
+func (lg *loopGuard) forget() {
+	lg.seen = make(map[uint64]int)
+}
+
+// replay
+// Registers steps of restored history without checking limits
+// Cycle detection starts over, as it does after an event
+func (lg *loopGuard) replay(history History) {
+	lg.reset()
+	for idx := range history {
+		lg.register(history[:idx+1])
+	}
+}
+
+// register
+// Counts the last history step against the budgets
+func (lg *loopGuard) register(history History) {
+	last := len(history) - 1
+	lg.steps++
+	lg.visits[history[last].to]++
+	lg.lastVisit[history[last].to] = last
+}
+
+// admit
+// Checks if one more step from one state to another fits the budgets, before it's made
+// Empty target means it's not known yet, so only step budget is checked
+// Returns an error describing the trail leading to the state if some budget would be exceeded
+func (lg *loopGuard) admit(history History, from string, to string) *FsmError {
+	// trail starts with the last visit of the target (or of the current state, if target is not known)
+	trail := func() []string {
+		anchor := to
+		if anchor == "" {
+			anchor = from
+		}
+		states := []string{from}
+		if previous, visited := lg.lastVisit[anchor]; visited {
+			states = states[:0]
+			for idx := previous; idx < len(history); idx++ {
+				states = append(states, history[idx].to)
+			}
+		}
+		if to != "" {
+			states = append(states, to)
+		}
+		return states
+	}
+
+	if to != "" && lg.limits.MaxStateVisits > 0 && lg.visits[to] >= lg.limits.MaxStateVisits {
+		cause := fmt.Sprintf("state \"%s\" would be entered more than %d times", to, lg.limits.MaxStateVisits)
+		return newFsmErrorStepLimit(cause, trail())
+	}
+	if lg.limits.MaxSteps > 0 && lg.steps >= lg.limits.MaxSteps {
+		cause := fmt.Sprintf("more than %d steps would be made", lg.limits.MaxSteps)
+		return newFsmErrorStepLimit(cause, trail())
+	}
+	return nil
+}
+
+// check
+// Checks if the step just made brought FSM to the configuration it has already been in
+// Returns an error describing the cycle if so
+func (lg *loopGuard) check(history History, stack *ContextStack) *FsmError {
+	if !lg.limits.DetectCycles || len(history) == 0 {
+		return nil
+	}
+	last := len(history) - 1
+
+	fp := fingerprint(stack)
+	if first, found := lg.seen[fp]; found {
+		cycle := make([]string, 0, last-first+1)
+		for idx := first; idx <= last; idx++ {
+			cycle = append(cycle, history[idx].to)
+		}
+		return newFsmErrorInfiniteLoop("state and contexts are repeated", cycle)
+	}
+	lg.seen[fp] = last
+	return nil
+}
+
+// fingerprint
+// Calculates hash of active states and their contexts
+func fingerprint(stack *ContextStack) uint64 {
+	h := fnv.New64a()
+	var walk func(*ContextStack)
+	walk = func(stack *ContextStack) {
+		for _, elem := range stack.stack {
+			// fmt prints maps with sorted keys, so output is stable
+			fmt.Fprintf(h, "%s:%v;", elem.state.Name, elem.context.members)
+			for _, region := range elem.regions {
+				h.Write([]byte("["))
+				walk(region)
+				h.Write([]byte("]"))
+			}
+		}
+	}
+	walk(stack)
+	return h.Sum64()
+}
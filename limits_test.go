@@ -0,0 +1,154 @@
+package simple_fsm
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func makeLoopStructure(action *PackagedAction) *Structure {
+	return MakeStructure(nil,
+		NewState("a", NewTransitionAlways("a-b", "b", action)),
+		NewState("b", NewTransitionAlways("b-a", "a", nil)),
+	)
+}
+
+func TestFsmLimitsCycle(t *testing.T) {
+	fsm := NewFsm(makeLoopStructure(nil), WithLimits(FsmLimits{DetectCycles: true}))
+	_, err := fsm.Run()
+	if err == nil || !fsm.Fatal() {
+		t.Log("FSM should be fatal (cycle detected)")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+	if !strings.Contains(err.Error(), "a -> b -> a") {
+		t.Logf("Error should describe the cycle: %s", err)
+		t.FailNow()
+	}
+}
+
+func TestFsmLimitsVisits(t *testing.T) {
+	var counter int
+	count := NewAction(func(ctx ContextOperator) error { counter++; ctx.PutParent("counter", counter); return nil })
+
+	fsm := NewFsm(makeLoopStructure(count), WithLimits(FsmLimits{MaxStateVisits: 3}))
+	if fsm.Run(); !fsm.Fatal() || len(fsm.History()) != 6 {
+		t.Logf("FSM should be fatal before 4th visit of the same state, history:\n%s", fsm.history.Dump())
+		t.FailNow()
+	}
+	if _, err := fsm.Advance(); err == nil || !strings.Contains(err.Error(), "trail: a -> b -> a") {
+		t.Logf("Error should describe the trail leading to the state: %s", err)
+		t.FailNow()
+	}
+}
+
+func TestFsmLimitsSteps(t *testing.T) {
+	var counter int
+	count := NewAction(func(ctx ContextOperator) error { counter++; return nil })
+
+	fsm := NewFsm(makeLoopStructure(count), WithLimits(FsmLimits{MaxSteps: 9}))
+	if fsm.Run(); !fsm.Fatal() || len(fsm.History()) != 9 {
+		t.Logf("FSM should be fatal before 10th step, history:\n%s", fsm.history.Dump())
+		t.FailNow()
+	}
+	if counter != 4 {
+		t.Logf("Actions of the step exceeding the budget should not be executed, counter: %d", counter)
+		t.FailNow()
+	}
+	if _, err := fsm.Advance(); err == nil || strings.Contains(err.Error(), "cycle") || !strings.Contains(err.Error(), "trail: b -> a -> b") {
+		t.Logf("Error should describe the trail leading to the step: %s", err)
+		t.FailNow()
+	}
+
+	fsm.Reset()
+	for idx := 0; idx < 9; idx++ {
+		fsm.Advance()
+	}
+	if fsm.Fatal() {
+		t.Log("Step counter should be reset along with FSM")
+		t.FailNow()
+	}
+}
+
+// makeRegionLoopStructure
+// Parallel state, which regions step at once
+func makeRegionLoopStructure() *Structure {
+	fstr := NewStructure()
+	split := NewState("split", nil)
+	split.Done = NewTransitionAlways("split-joined", "joined", nil)
+	fstr.AddStartState(split, nil)
+
+	left, right := NewState("left", nil), NewState("right", nil)
+	fstr.AddRegion(left, split)
+	fstr.AddRegion(right, split)
+	fstr.AddStartState(NewState("l1", NewTransitionAlways("l1-l2", "l2", nil)), left)
+	fstr.AddState(NewState("l2", nil), left)
+	fstr.AddStartState(NewState("r1", NewTransitionAlways("r1-r2", "r2", nil)), right)
+	fstr.AddState(NewState("r2", nil), right)
+
+	fstr.AddState(NewState("joined", nil), nil)
+	return fstr
+}
+
+func TestFsmLimitsRegions(t *testing.T) {
+	fsm := NewFsm(makeRegionLoopStructure(), WithLimits(FsmLimits{MaxSteps: 10}))
+	fsm.Advance()
+	fsm.Advance()
+	if len(fsm.History()) != 3 || fsm.loops.steps != 3 {
+		t.Logf("Step of every region should be counted, steps: %d, history:\n%s", fsm.loops.steps, fsm.history.Dump())
+		t.FailNow()
+	}
+
+	restored := roundTrip(t, fsm)
+	if restored.loops.steps != fsm.loops.steps || !reflect.DeepEqual(restored.loops.visits, fsm.loops.visits) {
+		t.Logf("Restored budgets should be the same, steps: %d, visits: %v", restored.loops.steps, restored.loops.visits)
+		t.FailNow()
+	}
+
+	fsm = NewFsm(makeRegionLoopStructure(), WithLimits(FsmLimits{MaxSteps: 2}))
+	fsm.Advance()
+	if _, err := fsm.Advance(); err == nil || err.Kind() != ErrFsmInfiniteLoop || len(fsm.History()) != 2 {
+		t.Logf("Region step exceeding the budget should not be made, error: %v, history:\n%s", err, fsm.history.Dump())
+		t.FailNow()
+	}
+}
+
+func TestLoopGuardEvents(t *testing.T) {
+	fsm := NewFsm(MakeStructure(nil,
+		NewState("a", []Transition{NewEventTransition("a-b", "go", "b", nil, nil)}),
+		NewState("b", []Transition{NewEventTransition("b-a", "go", "a", nil, nil)}),
+	), WithLimits(FsmLimits{DetectCycles: true}))
+
+	fsm.Advance()
+	for idx := 0; idx < 4; idx++ {
+		if _, err := fsm.Fire("go", nil); err != nil {
+			t.Logf("Event driven loops should not be treated as infinite: %s", err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestFsmLimitsChoice(t *testing.T) {
+	var counter int
+	count := NewAction(func(ctx ContextOperator) error { counter++; return nil })
+
+	fsm := NewFsm(MakeStructure(nil,
+		NewState("a", NewTransitionAlways("a-choice", "choice", count)),
+		NewChoice("choice", []Transition{NewElseTransition("choice-b", "b", nil)}),
+		NewState("b", nil),
+	), WithLimits(FsmLimits{MaxSteps: 1}))
+	fsm.Advance()
+
+	if _, err := fsm.Advance(); err == nil || err.Kind() != ErrFsmInfiniteLoop {
+		t.Logf("Step into a choice should exceed the budget: %v", err)
+		t.FailNow()
+	}
+	if counter != 0 || len(fsm.History()) != 1 || fsm.stack.Peek().state.Name != "a" {
+		t.Logf("Step into a choice should not be taken, counter: %d\n%s", counter, Dump(fsm))
+		t.FailNow()
+	}
+	if _, err := fsm.Advance(); err == nil || !strings.Contains(err.Error(), "more than 1 steps would be made, trail: a\n") {
+		t.Logf("Error should describe the trail leading to the step: %s", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,63 @@
+package simple_fsm
+
+// Listener
+// Observer of FSM lifecycle, called synchronously while FSM makes a step
+// step is an index of the history item being made
+// * OnGuardEvaluated - guard of the transition declared by the state was evaluated
+// * OnTransitionStart - transition declared by the state is about to be taken
+// * OnStateExit - state was exited (after its exit action)
+// * OnStateEnter - state was entered (after its entry action)
+// * OnActionDone - action was executed (after all attempts)
+// * OnCompleted - FSM has reached its final state, result is available
+// * OnFatal - FSM went into fatal state
+// Transition is only reported for transition actions, compensations are
+// reported with the state they were registered by
+type Listener interface {
+	OnGuardEvaluated(step int, state *StateInfo, transition *Transition, open bool, err error)
+	OnTransitionStart(step int, state *StateInfo, transition *Transition)
+	OnStateExit(step int, state *StateInfo)
+	OnStateEnter(step int, state *StateInfo)
+	OnActionDone(step int, state *StateInfo, transition *Transition, who string, err error)
+	OnCompleted(step int, result interface{})
+	OnFatal(step int, err *FsmError)
+}
+
+// NopListener
+// Listener ignoring everything, can be embedded to implement only needed methods
+type NopListener struct{}
+
+func (NopListener) OnGuardEvaluated(int, *StateInfo, *Transition, bool, error) {}
+func (NopListener) OnTransitionStart(int, *StateInfo, *Transition)             {}
+func (NopListener) OnStateExit(int, *StateInfo)                                {}
+func (NopListener) OnStateEnter(int, *StateInfo)                               {}
+func (NopListener) OnActionDone(int, *StateInfo, *Transition, string, error)   {}
+func (NopListener) OnCompleted(int, interface{})                               {}
+func (NopListener) OnFatal(int, *FsmError)                                     {}
+
+// WithListener
+// Registers lifecycle listener (see Listener)
+func WithListener(listener Listener) FsmOption {
+	return func(fsm *Fsm) {
+		fsm.AddListener(listener)
+	}
+}
+
+// AddListener
+// Registers lifecycle listener, listeners are called in registration order
+func (fsm *Fsm) AddListener(listener Listener) {
+	fsm.listeners = append(fsm.listeners, listener)
+}
+
+// notify
+// Calls given function for every registered listener
+func (fsm *Fsm) notify(fn func(Listener)) {
+	for _, listener := range fsm.listeners {
+		fn(listener)
+	}
+}
+
+// notifyAction
+// Reports executed action to listeners
+func (fsm *Fsm) notifyAction(state *StateInfo, transition *Transition, who string, err error) {
+	fsm.notify(func(l Listener) { l.OnActionDone(fsm.stepIdx, state, transition, who, err) })
+}
@@ -0,0 +1,59 @@
+package simple_fsm
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFsmListener(t *testing.T) {
+	listener := &traceListener{}
+	fsm := NewFsm(makeListenerStructure(false), WithListener(listener))
+	fsm.Run()
+
+	expected := []string{
+		"0 guard global/Always global->1 true",
+		"0 start global/Always global->1",
+		"0 state entry action 1 <nil>",
+		"0 enter 1",
+		"1 guard 1/1-2 true",
+		"1 start 1/1-2",
+		"1 exit 1",
+		"1 enter 2",
+		"1 transition action 1/1-2 <nil>",
+		"1 completed 42",
+	}
+	if !reflect.DeepEqual(listener.events, expected) {
+		t.Logf("Listener should observe the run:\n%v", listener.events)
+		t.FailNow()
+	}
+}
+
+func TestFsmListenerFatal(t *testing.T) {
+	listener := &traceListener{}
+	fsm := NewFsm(makeListenerStructure(true))
+	fsm.AddListener(listener)
+	fsm.Run()
+
+	last := listener.events[len(listener.events)-2:]
+	if last[0] != "1 transition action 1/1-2 boom" || last[1] != "1 fatal" {
+		t.Logf("Listener should observe failure: %v", listener.events)
+		t.FailNow()
+	}
+}
+
+func TestFsmListenerLimits(t *testing.T) {
+	listener := &traceListener{}
+	fsm := NewFsm(makeListenerStructure(false), WithListener(listener), WithLimits(FsmLimits{MaxSteps: 1}))
+	fsm.Run()
+
+	for _, event := range listener.events {
+		if event == "1 completed 42" {
+			t.Logf("Step exceeding the budget should not be reported as completed: %v", listener.events)
+			t.FailNow()
+		}
+	}
+	if last := listener.events[len(listener.events)-1]; last != "1 fatal" {
+		t.Logf("Listener should observe failure: %v", listener.events)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,131 @@
+package simple_fsm
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// WithLogger
+// Makes FSM emit structured log records of its run
+// * Debug - guard outcomes and actions executed along with their duration
+// * Info - steps made and FSM completion
+// * Warn - failed actions and steps, FSM stays operational
+// * Error - FSM went into fatal state
+// Every record carries step index and instance ID (if FSM is bound to a store or a journal),
+// errors are logged along with their kind (see FsmErrorKind)
+func WithLogger(logger *slog.Logger) FsmOption {
+	return func(fsm *Fsm) {
+		fsm.logger = logger
+	}
+}
+
+// instanceID
+// Returns ID FSM instance is stored or journaled under, empty if there's none
+func (fsm *Fsm) instanceID() string {
+	switch {
+	case fsm.persistence != nil:
+		return fsm.persistence.id
+	case fsm.journal != nil:
+		return fsm.journal.id
+	}
+	return ""
+}
+
+// log
+// Emits a record of the step being made (if FSM has a logger)
+func (fsm *Fsm) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	if fsm.logger == nil {
+		return
+	}
+	ctx := fsm.stack.goCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !fsm.logger.Enabled(ctx, level) {
+		return
+	}
+
+	common := make([]slog.Attr, 0, len(attrs)+2)
+	if id := fsm.instanceID(); id != "" {
+		common = append(common, slog.String("instance", id))
+	}
+	common = append(common, slog.Int("step", fsm.stepIdx))
+	fsm.logger.LogAttrs(ctx, level, msg, append(common, attrs...)...)
+}
+
+// logGuard
+// Logs guard evaluation outcome
+func (fsm *Fsm) logGuard(state *StateInfo, tr *Transition, open bool, e error) {
+	fsm.log(slog.LevelDebug, "guard evaluated", append([]slog.Attr{
+		slog.String("state", state.Name),
+		slog.String("transition", tr.Name),
+		slog.Bool("open", open),
+	}, errorAttrs(e)...)...)
+}
+
+// logAction
+// Logs executed action (after all attempts) and time it took
+func (fsm *Fsm) logAction(who string, name string, duration time.Duration, e error) {
+	level, msg := slog.LevelDebug, "action done"
+	if e != nil {
+		level, msg = slog.LevelWarn, "action failed"
+	}
+	fsm.log(level, msg, append([]slog.Attr{
+		slog.String("who", who),
+		slog.String("name", name),
+		slog.Duration("duration", duration),
+	}, errorAttrs(e)...)...)
+}
+
+// logStep
+// Logs history item made
+func (fsm *Fsm) logStep(step *HistoryItem) {
+	attrs := []slog.Attr{
+		slog.String("from", step.from),
+		slog.String("to", step.to),
+		slog.String("transition", step.transition),
+	}
+	if step.event != "" {
+		attrs = append(attrs, slog.String("event", step.event))
+	}
+	if len(step.path) > 0 {
+		attrs = append(attrs, slog.Any("path", step.path))
+	}
+	fsm.log(slog.LevelInfo, "step made", attrs...)
+}
+
+// logStepFailed
+// Logs step error that didn't put FSM into fatal state (the one that did is logged by goFatal)
+// Steps not made for lack of opened transitions are not failures, they are logged as debug
+func (fsm *Fsm) logStepFailed(err *FsmError) {
+	level := slog.LevelWarn
+	if unhandled(err) {
+		level = slog.LevelDebug
+	}
+	fsm.log(level, "step failed", errorAttrs(err)...)
+}
+
+// errorAttrs
+// Returns attributes describing an error, kind is added for FSM errors
+func errorAttrs(e error) []slog.Attr {
+	if e == nil {
+		return nil
+	}
+	attrs := []slog.Attr{slog.String("error", e.Error())}
+	var fsmErr *FsmError
+	if errors.As(e, &fsmErr) {
+		attrs = append(attrs, slog.String("kind", fsmErr.Kind().String()))
+	}
+	return attrs
+}
+
+// logLoading
+// Emits a structure loading record (if logger is given)
+func logLoading(logger *slog.Logger, level slog.Level, msg string, attrs ...slog.Attr) {
+	if logger == nil {
+		return
+	}
+	logger.LogAttrs(context.Background(), level, msg, attrs...)
+}
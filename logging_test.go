@@ -0,0 +1,196 @@
+package simple_fsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// logRecords
+// Parses records written by JSON handler
+func logRecords(t *testing.T, buf *bytes.Buffer) (records []map[string]interface{}) {
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		record := make(map[string]interface{})
+		if err := dec.Decode(&record); err != nil {
+			t.Logf("Log record is not valid json: %s", err.Error())
+			t.FailNow()
+		}
+		records = append(records, record)
+	}
+	return
+}
+
+// logMessages
+// Returns "level message" strings of the records
+func logMessages(records []map[string]interface{}) (messages []string) {
+	for _, record := range records {
+		messages = append(messages, record["level"].(string)+" "+record["msg"].(string))
+	}
+	return
+}
+
+func newTestLogger(buf *bytes.Buffer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+}
+
+func TestFsmLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	fsm := NewFsm(makeListenerStructure(false),
+		WithLogger(newTestLogger(buf)),
+		WithStore(NewMemoryStore(), "order-1"),
+		WithClock(&tickingClock{tick: 5 * time.Millisecond}),
+	)
+	if _, err := fsm.Run(); err != nil {
+		t.Logf("Run failed: %s", err.Error())
+		t.FailNow()
+	}
+
+	records := logRecords(t, buf)
+	expected := []string{
+		"DEBUG guard evaluated",
+		"DEBUG action done",
+		"INFO step made",
+		"DEBUG guard evaluated",
+		"INFO step made",
+		"DEBUG action done",
+		"INFO completed",
+	}
+	if messages := logMessages(records); !reflect.DeepEqual(messages, expected) {
+		t.Logf("Logged records are different from expected:\n%v", messages)
+		t.FailNow()
+	}
+
+	for _, record := range records {
+		if record["instance"] != "order-1" {
+			t.Logf("Record should carry instance ID: %v", record)
+			t.FailNow()
+		}
+	}
+
+	guard, step, action := records[3], records[4], records[5]
+	if guard["step"] != 1.0 || guard["state"] != "1" || guard["transition"] != "1-2" || guard["open"] != true {
+		t.Logf("Guard record is different from expected: %v", guard)
+		t.FailNow()
+	}
+	if step["from"] != "1" || step["to"] != "2" || step["transition"] != "1-2" {
+		t.Logf("Step record is different from expected: %v", step)
+		t.FailNow()
+	}
+	if action["who"] != "transition action" || action["name"] != "1-2" || action["duration"] != float64(5*time.Millisecond) {
+		t.Logf("Action record is different from expected: %v", action)
+		t.FailNow()
+	}
+}
+
+func TestFsmLoggerFailures(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	fsm := NewFsm(makeListenerStructure(true), WithLogger(logger))
+	fsm.Run()
+
+	records := logRecords(t, buf)
+	expected := []string{"WARN action failed", "ERROR fatal"}
+	if messages := logMessages(records); !reflect.DeepEqual(messages, expected) {
+		t.Logf("Logged records are different from expected:\n%v", messages)
+		t.FailNow()
+	}
+	if records[0]["error"] != "boom" || records[0]["kind"] != nil {
+		t.Logf("Action failure should be logged: %v", records[0])
+		t.FailNow()
+	}
+	if records[1]["kind"] != "ErrFsmCallbackFailed" || records[1]["step"] != 1.0 {
+		t.Logf("Fatal error should be logged along with its kind: %v", records[1])
+		t.FailNow()
+	}
+
+	// fatal FSM refuses to advance, that's not logged again
+	buf.Reset()
+	fsm.Advance()
+	if buf.Len() != 0 {
+		t.Logf("Advancing fatal FSM shouldn't be logged: %s", buf.String())
+		t.FailNow()
+	}
+}
+
+func TestFsmLoggerStepFailed(t *testing.T) {
+	buf := &bytes.Buffer{}
+	structure := MakeStructure(nil,
+		NewState("1", []Transition{NewEventTransition("1-2", "go", "2", nil, nil)}),
+		NewState("2", nil),
+	)
+	fsm := NewFsm(structure, WithLogger(newTestLogger(buf)))
+	fsm.Advance()
+	buf.Reset()
+
+	if _, err := fsm.Fire("stop", nil); err == nil || err.Kind() != ErrFsmEventUnhandled {
+		t.Logf("Event should be unhandled: %v", err)
+		t.FailNow()
+	}
+	records := logRecords(t, buf)
+	if len(records) != 1 || records[0]["level"] != "DEBUG" || records[0]["kind"] != "ErrFsmEventUnhandled" {
+		t.Logf("Unhandled event should be logged as debug: %v", records)
+		t.FailNow()
+	}
+}
+
+func TestBuilderLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	actions := ActionMap{
+		"setnext":     func(ctx ContextOperator) error { return nil },
+		"setresult13": func(ctx ContextOperator) error { return nil },
+		"setresult42": func(ctx ContextOperator) error { return nil },
+	}
+	bld := NewBuilder(actions).WithLogger(newTestLogger(buf)).FromJsonFile("./fsm-sample.json")
+	fsm, err := bld.Fsm()
+	if err != nil {
+		t.Logf("Structure construction failed, %s", err.Error())
+		t.FailNow()
+	}
+
+	records := logRecords(t, buf)
+	last := records[len(records)-1]
+	if last["msg"] != "structure loaded" || last["states"] != float64(len(records)-1) {
+		t.Logf("Every loaded state should be logged: %v", records)
+		t.FailNow()
+	}
+	for _, record := range records[:len(records)-1] {
+		if record["msg"] != "state loaded" || record["state"] == "" {
+			t.Logf("State record is different from expected: %v", record)
+			t.FailNow()
+		}
+	}
+
+	if fsm.logger == nil {
+		t.Log("FSM constructed by builder should inherit its logger")
+		t.FailNow()
+	}
+
+	buf.Reset()
+	js := makeJsonStates(pC{"1", "", ""}, pC{"2", "", ""})
+	js["2"] = JsonState{Start: true}
+	if _, err = NewBuilder(ActionMap{}).WithLogger(newTestLogger(buf)).FromJsonType(JsonRoot{"states": js}).Structure(); err == nil {
+		t.Log("Several entry points should fail loading")
+		t.FailNow()
+	}
+	records = logRecords(t, buf)
+	last = records[len(records)-1]
+	if last["level"] != "ERROR" || last["kind"] != "ErrFsmLoading" {
+		t.Logf("Loading failure should be logged: %v", last)
+		t.FailNow()
+	}
+}
+
+func TestFsmErrorKindString(t *testing.T) {
+	if ErrCtxKeyNotFound.String() != "ErrCtxKeyNotFound" || ErrFsmDiverged.String() != "ErrFsmDiverged" {
+		t.Log("Error kinds should be named as declared")
+		t.FailNow()
+	}
+	if FsmErrorKind(-1).String() != "FsmErrorKind(-1)" {
+		t.Logf("Unknown error kind name is different from expected: %s", FsmErrorKind(-1))
+		t.FailNow()
+	}
+}
@@ -0,0 +1,242 @@
+package simple_fsm
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MetricsCollector
+// Receiver of runtime measurements made by FSM instances sharing the structure (see Structure.SetMetrics)
+// Called synchronously while FSM makes a step, implementation should be goroutine-safe
+// * ObserveTransition - transition declared by the state was taken
+// * ObserveStateDwell - state was exited after being active for given time
+// * ObserveGuard - guard of the transition declared by the state was evaluated
+// * ObserveAction - action was executed (all attempts included), name is transition, state or compensation name
+// * ObserveFatal - FSM went into fatal state because of an error of given kind
+type MetricsCollector interface {
+	ObserveTransition(state string, transition string)
+	ObserveStateDwell(state string, duration time.Duration)
+	ObserveGuard(state string, transition string, duration time.Duration, err error)
+	ObserveAction(who string, name string, duration time.Duration, err error)
+	ObserveFatal(kind FsmErrorKind)
+}
+
+// SetMetrics
+// Makes all FSM instances using the structure report measurements to the collector
+// Should be set before instances are run, nil disables metrics
+func (fstr *Structure) SetMetrics(collector MetricsCollector) {
+	fstr.metrics = collector
+}
+
+// Metrics
+// Returns collector measurements are reported to, nil if there's none
+func (fstr *Structure) Metrics() MetricsCollector {
+	return fstr.metrics
+}
+
+// DefaultMetricsBuckets
+// Upper bounds (in seconds) of histogram buckets used unless others are given,
+// wide enough to cover both callback latency and time spent awaiting events
+var DefaultMetricsBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 60, 300, 3600}
+
+// metricKey
+// Identifies a series: state, transition or action name along with its qualifier
+type metricKey struct {
+	name      string
+	qualifier string
+}
+
+// histogram
+// Cumulative distribution of observed durations
+// counts[i] is a number of observations that are not greater than i-th bucket bound
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// observe
+// Adds an observation (in seconds)
+func (h *histogram) observe(buckets []float64, value float64) {
+	for idx, bound := range buckets {
+		if value <= bound {
+			h.counts[idx]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// Metrics
+// Collector aggregating measurements in memory: transition and failure counters,
+// state dwell time, guard and action latency histograms, goroutine-safe
+// Aggregated values can be exposed in Prometheus text format (see WritePrometheus)
+type Metrics struct {
+	mu      sync.Mutex
+	name    string
+	buckets []float64
+
+	transitions  map[metricKey]uint64
+	dwell        map[metricKey]*histogram
+	guards       map[metricKey]*histogram
+	guardErrors  map[metricKey]uint64
+	actions      map[metricKey]*histogram
+	actionErrors map[metricKey]uint64
+	fatal        map[FsmErrorKind]uint64
+}
+
+// NewMetrics
+// Constructs empty in-memory collector
+// Non-empty name is exposed as "fsm" label, so several collectors can share one exposition
+// Bucket bounds (in seconds) should be sorted, DefaultMetricsBuckets are used if there're none
+func NewMetrics(name string, buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultMetricsBuckets
+	}
+	return &Metrics{
+		name:         name,
+		buckets:      append([]float64(nil), buckets...),
+		transitions:  make(map[metricKey]uint64),
+		dwell:        make(map[metricKey]*histogram),
+		guards:       make(map[metricKey]*histogram),
+		guardErrors:  make(map[metricKey]uint64),
+		actions:      make(map[metricKey]*histogram),
+		actionErrors: make(map[metricKey]uint64),
+		fatal:        make(map[FsmErrorKind]uint64),
+	}
+}
+
+// observe
+// Adds an observation to the series of histogram family
+func (m *Metrics) observe(family map[metricKey]*histogram, key metricKey, duration time.Duration) {
+	h, found := family[key]
+	if !found {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		family[key] = h
+	}
+	h.observe(m.buckets, duration.Seconds())
+}
+
+// MetricsCollector.ObserveTransition
+func (m *Metrics) ObserveTransition(state string, transition string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transitions[metricKey{state, transition}]++
+}
+
+// MetricsCollector.ObserveStateDwell
+func (m *Metrics) ObserveStateDwell(state string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observe(m.dwell, metricKey{name: state}, duration)
+}
+
+// MetricsCollector.ObserveGuard
+func (m *Metrics) ObserveGuard(state string, transition string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := metricKey{state, transition}
+	m.observe(m.guards, key, duration)
+	if err != nil {
+		m.guardErrors[key]++
+	}
+}
+
+// MetricsCollector.ObserveAction
+func (m *Metrics) ObserveAction(who string, name string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := metricKey{name, who}
+	m.observe(m.actions, key, duration)
+	if err != nil {
+		m.actionErrors[key]++
+	}
+}
+
+// MetricsCollector.ObserveFatal
+func (m *Metrics) ObserveFatal(kind FsmErrorKind) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fatal[kind]++
+}
+
+// Transitions
+// Returns how many times transition declared by the state was taken
+func (m *Metrics) Transitions(state string, transition string) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.transitions[metricKey{state, transition}]
+}
+
+// Fatal
+// Returns how many times FSMs went into fatal state because of an error of given kind
+func (m *Metrics) Fatal(kind FsmErrorKind) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.fatal[kind]
+}
+
+// sortKeys
+// Sorts series keys in lexical order, so exposition is stable
+func sortKeys(keys []metricKey) []metricKey {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].qualifier < keys[j].qualifier
+	})
+	return keys
+}
+
+// measureStart
+// Returns the time measurement starts at, zero if metrics are disabled
+func (fsm *Fsm) measureStart() time.Time {
+	if fsm.structure.metrics == nil {
+		return time.Time{}
+	}
+	return fsm.clock.Now()
+}
+
+// observeTransition, observeGuard, observeAction, observeFatal
+// Report measurements to the structure collector (if any)
+func (fsm *Fsm) observeTransition(state *StateInfo, transition *Transition) {
+	if collector := fsm.structure.metrics; collector != nil {
+		collector.ObserveTransition(state.Name, transition.Name)
+	}
+}
+
+func (fsm *Fsm) observeGuard(state *StateInfo, transition *Transition, start time.Time, err error) {
+	if collector := fsm.structure.metrics; collector != nil {
+		collector.ObserveGuard(state.Name, transition.Name, fsm.clock.Now().Sub(start), err)
+	}
+}
+
+func (fsm *Fsm) observeAction(who string, name string, duration time.Duration, err error) {
+	if collector := fsm.structure.metrics; collector != nil {
+		collector.ObserveAction(who, name, duration, err)
+	}
+}
+
+func (fsm *Fsm) observeFatal(cause *FsmError) {
+	if collector := fsm.structure.metrics; collector != nil {
+		collector.ObserveFatal(cause.Kind())
+	}
+}
+
+// markEntered
+// Remembers when the state was entered, so its dwell time can be measured on exit
+// States restored from a snapshot have no entry time, their dwell time is not observed
+func (fsm *Fsm) markEntered(sc *StateContext) {
+	if fsm.structure.metrics != nil {
+		sc.entered = fsm.clock.Now()
+	}
+}
+
+// observeExit
+// Reports dwell time of the state being exited
+func (fsm *Fsm) observeExit(sc *StateContext) {
+	if collector := fsm.structure.metrics; collector != nil && !sc.entered.IsZero() {
+		collector.ObserveStateDwell(sc.state.Name, fsm.clock.Now().Sub(sc.entered))
+	}
+}
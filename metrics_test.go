@@ -0,0 +1,71 @@
+package simple_fsm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFsmMetrics(t *testing.T) {
+	structure := makeListenerStructure(false)
+	metrics := NewMetrics("")
+	structure.SetMetrics(metrics)
+
+	for idx := 0; idx < 3; idx++ {
+		fsm := NewFsm(structure, WithClock(&tickingClock{tick: 10 * time.Millisecond}))
+		if _, err := fsm.Run(); err != nil {
+			t.Logf("Run failed: %s", err.Error())
+			t.FailNow()
+		}
+	}
+
+	if count := metrics.Transitions("1", "1-2"); count != 3 {
+		t.Logf("Transitions taken by all instances should be counted, got %d", count)
+		t.FailNow()
+	}
+	if count := metrics.Transitions("2", "1-2"); count != 0 {
+		t.Logf("Transitions should be counted by declaring state, got %d", count)
+		t.FailNow()
+	}
+
+	dwell := metrics.dwell[metricKey{name: "1"}]
+	if dwell == nil || dwell.count != 3 || metrics.dwell[metricKey{name: "2"}] != nil {
+		t.Logf("Dwell time of exited states should be observed: %v", metrics.dwell)
+		t.FailNow()
+	}
+
+	// guard and action measurements take a single tick
+	guard := metrics.guards[metricKey{"1", "1-2"}]
+	if guard == nil || guard.count != 3 || guard.counts[1] != 0 || guard.counts[2] != 3 {
+		t.Logf("Guard latency is different from expected: %v", guard)
+		t.FailNow()
+	}
+	action := metrics.actions[metricKey{"1-2", "transition action"}]
+	if action == nil || action.count != 3 || action.sum < 0.0299 || action.sum > 0.0301 {
+		t.Logf("Action latency is different from expected: %v", action)
+		t.FailNow()
+	}
+}
+
+func TestFsmMetricsFatal(t *testing.T) {
+	structure := makeListenerStructure(true)
+	metrics := NewMetrics("")
+	structure.SetMetrics(metrics)
+
+	fsm := NewFsm(structure)
+	fsm.Run()
+	if count := metrics.Fatal(ErrFsmCallbackFailed); count != 1 {
+		t.Logf("Fatal errors should be counted by kind, got %d", count)
+		t.FailNow()
+	}
+	if count := metrics.actionErrors[metricKey{"1-2", "transition action"}]; count != 1 {
+		t.Logf("Failed actions should be counted, got %d", count)
+		t.FailNow()
+	}
+
+	structure.SetMetrics(nil)
+	NewFsm(structure).Run()
+	if count := metrics.Fatal(ErrFsmCallbackFailed); count != 1 {
+		t.Logf("Metrics should be disabled, got %d", count)
+		t.FailNow()
+	}
+}
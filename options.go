@@ -0,0 +1,61 @@
+package simple_fsm
+
+// ConflictPolicy
+// Enum-like type describing how FSM treats several opened transitions
+type ConflictPolicy int
+
+const (
+	// ConflictStrict
+	// Several opened transitions put FSM into fatal state
+	ConflictStrict ConflictPolicy = iota
+	// ConflictFirstMatch
+	// Transitions are checked by descending priority (then in declaration order),
+	// first opened one is taken
+	ConflictFirstMatch
+	// ConflictError
+	// Several opened transitions are reported as an error, FSM stays where it was
+	ConflictError
+)
+
+// FsmOption
+// Optional FSM setting, applied on construction (see NewFsm)
+type FsmOption func(*Fsm)
+
+// WithConflictPolicy
+// Defines how FSM resolves several opened transitions (ConflictStrict by default)
+func WithConflictPolicy(policy ConflictPolicy) FsmOption {
+	return func(fsm *Fsm) {
+		fsm.policy = policy
+	}
+}
+
+// TransitionPrecedence
+// Enum-like type describing which of active states (head or its ancestors)
+// gets to choose the transition first
+type TransitionPrecedence int
+
+const (
+	// PrecedenceInner
+	// Transitions of the innermost state are considered first,
+	// then the ones of its parent and so on
+	PrecedenceInner TransitionPrecedence = iota
+	// PrecedenceOuter
+	// Transitions of the outermost state are considered first
+	PrecedenceOuter
+)
+
+// WithPrecedence
+// Defines the order of considering transitions of active states (PrecedenceInner by default)
+func WithPrecedence(precedence TransitionPrecedence) FsmOption {
+	return func(fsm *Fsm) {
+		fsm.precedence = precedence
+	}
+}
+
+// WithClock
+// Replaces system clock used by FSM (waiting between action attempts, timestamps)
+func WithClock(clock Clock) FsmOption {
+	return func(fsm *Fsm) {
+		fsm.clock = clock
+	}
+}
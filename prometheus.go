@@ -0,0 +1,166 @@
+package simple_fsm
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// promLabel, promSample, promFamily
+// Metric families as they are exposed in Prometheus text format
+type promLabel struct {
+	name  string
+	value string
+}
+type promSample struct {
+	suffix string
+	labels []promLabel
+	value  float64
+}
+type promFamily struct {
+	name    string
+	help    string
+	kind    string
+	samples []promSample
+}
+
+// labels
+// Returns series labels, prefixed with collector name (if any)
+func (m *Metrics) labels(labels ...promLabel) []promLabel {
+	if m.name == "" {
+		return labels
+	}
+	return append([]promLabel{{"fsm", m.name}}, labels...)
+}
+
+// counter
+// Converts counter series to a family
+func (m *Metrics) counter(name string, help string, series map[metricKey]uint64, labels func(metricKey) []promLabel) promFamily {
+	family := promFamily{name: name, help: help, kind: "counter"}
+	keys := make([]metricKey, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	for _, key := range sortKeys(keys) {
+		family.samples = append(family.samples, promSample{"", m.labels(labels(key)...), float64(series[key])})
+	}
+	return family
+}
+
+// histogram
+// Converts histogram series to a family: cumulative buckets, sum and count of every series
+func (m *Metrics) histogram(name string, help string, series map[metricKey]*histogram, labels func(metricKey) []promLabel) promFamily {
+	family := promFamily{name: name, help: help, kind: "histogram"}
+	keys := make([]metricKey, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	for _, key := range sortKeys(keys) {
+		h, common := series[key], m.labels(labels(key)...)
+		for idx, bound := range m.buckets {
+			le := promLabel{"le", strconv.FormatFloat(bound, 'g', -1, 64)}
+			family.samples = append(family.samples, promSample{"_bucket", append(common[:len(common):len(common)], le), float64(h.counts[idx])})
+		}
+		family.samples = append(family.samples,
+			promSample{"_bucket", append(common[:len(common):len(common)], promLabel{"le", "+Inf"}), float64(h.count)},
+			promSample{"_sum", common, h.sum},
+			promSample{"_count", common, float64(h.count)},
+		)
+	}
+	return family
+}
+
+// families
+// Returns aggregated values of all metric families, always in the same order
+func (m *Metrics) families() []promFamily {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stateTransition := func(key metricKey) []promLabel {
+		return []promLabel{{"state", key.name}, {"transition", key.qualifier}}
+	}
+	state := func(key metricKey) []promLabel {
+		return []promLabel{{"state", key.name}}
+	}
+	action := func(key metricKey) []promLabel {
+		return []promLabel{{"who", key.qualifier}, {"action", key.name}}
+	}
+
+	fatal := promFamily{name: "fsm_fatal_total", help: "FSMs gone into fatal state, by error kind", kind: "counter"}
+	for kind := FsmErrorKind(0); int(kind) < len(fsmErrorKindNames); kind++ {
+		if count, found := m.fatal[kind]; found {
+			fatal.samples = append(fatal.samples, promSample{"", m.labels(promLabel{"kind", kind.String()}), float64(count)})
+		}
+	}
+
+	return []promFamily{
+		m.counter("fsm_transitions_total", "Transitions taken, by declaring state", m.transitions, stateTransition),
+		m.histogram("fsm_state_dwell_seconds", "Time spent in a state before leaving it", m.dwell, state),
+		m.histogram("fsm_guard_duration_seconds", "Guard evaluation latency", m.guards, stateTransition),
+		m.counter("fsm_guard_errors_total", "Guard evaluations failed", m.guardErrors, stateTransition),
+		m.histogram("fsm_action_duration_seconds", "Action latency, retry attempts included", m.actions, action),
+		m.counter("fsm_action_errors_total", "Actions failed after all attempts", m.actionErrors, action),
+		fatal,
+	}
+}
+
+// WritePrometheus
+// Writes aggregated values of given collectors in Prometheus text exposition format
+// Collectors should be named differently (see NewMetrics), their series are merged by family
+func WritePrometheus(w io.Writer, metrics ...*Metrics) error {
+	collected := make([][]promFamily, len(metrics))
+	for idx, m := range metrics {
+		collected[idx] = m.families()
+	}
+	if len(collected) == 0 {
+		return nil
+	}
+
+	buf := bufio.NewWriter(w)
+	for idx, family := range collected[0] {
+		buf.WriteString("# HELP " + family.name + " " + family.help + "\n")
+		buf.WriteString("# TYPE " + family.name + " " + family.kind + "\n")
+		for _, families := range collected {
+			for _, sample := range families[idx].samples {
+				writePromSample(buf, family.name, sample)
+			}
+		}
+	}
+	return buf.Flush()
+}
+
+// writePromSample
+// Writes a single sample line
+func writePromSample(buf *bufio.Writer, name string, sample promSample) {
+	buf.WriteString(name + sample.suffix)
+	if len(sample.labels) > 0 {
+		buf.WriteByte('{')
+		for idx, label := range sample.labels {
+			if idx > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(label.name + "=\"" + promEscaper.Replace(label.value) + "\"")
+		}
+		buf.WriteByte('}')
+	}
+	buf.WriteString(" " + strconv.FormatFloat(sample.value, 'g', -1, 64) + "\n")
+}
+
+// promEscaper
+// Escapes label values as required by text exposition format
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// MetricsHandler
+// Returns HTTP handler exposing given collectors in Prometheus text format (see WritePrometheus)
+func MetricsHandler(metrics ...*Metrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", PrometheusContentType)
+		WritePrometheus(w, metrics...)
+	})
+}
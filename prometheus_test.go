@@ -0,0 +1,70 @@
+package simple_fsm
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	orders := NewMetrics("orders", 0.1, 1)
+	orders.ObserveTransition("new", "new-paid")
+	orders.ObserveTransition("new", "new-paid")
+	orders.ObserveStateDwell("new", 500*time.Millisecond)
+	orders.ObserveAction("transition action", "new-paid", 50*time.Millisecond, errors.New("boom"))
+	orders.ObserveFatal(ErrFsmCallbackFailed)
+
+	quotes := NewMetrics(`say "hi"`, 0.1, 1)
+	quotes.ObserveTransition("a", "a-b")
+
+	buf := &bytes.Buffer{}
+	if err := WritePrometheus(buf, orders, quotes); err != nil {
+		t.Logf("Writing exposition failed: %s", err.Error())
+		t.FailNow()
+	}
+	text := buf.String()
+
+	expected := []string{
+		"# TYPE fsm_transitions_total counter\n" +
+			"fsm_transitions_total{fsm=\"orders\",state=\"new\",transition=\"new-paid\"} 2\n" +
+			"fsm_transitions_total{fsm=\"say \\\"hi\\\"\",state=\"a\",transition=\"a-b\"} 1\n",
+		"# TYPE fsm_state_dwell_seconds histogram\n" +
+			"fsm_state_dwell_seconds_bucket{fsm=\"orders\",state=\"new\",le=\"0.1\"} 0\n" +
+			"fsm_state_dwell_seconds_bucket{fsm=\"orders\",state=\"new\",le=\"1\"} 1\n" +
+			"fsm_state_dwell_seconds_bucket{fsm=\"orders\",state=\"new\",le=\"+Inf\"} 1\n" +
+			"fsm_state_dwell_seconds_sum{fsm=\"orders\",state=\"new\"} 0.5\n" +
+			"fsm_state_dwell_seconds_count{fsm=\"orders\",state=\"new\"} 1\n",
+		"fsm_action_errors_total{fsm=\"orders\",who=\"transition action\",action=\"new-paid\"} 1\n",
+		"fsm_fatal_total{fsm=\"orders\",kind=\"ErrFsmCallbackFailed\"} 1\n",
+	}
+	for _, part := range expected {
+		if !strings.Contains(text, part) {
+			t.Logf("Exposition should contain:\n%s\ngot:\n%s", part, text)
+			t.FailNow()
+		}
+	}
+	if strings.Count(text, "# TYPE fsm_transitions_total") != 1 {
+		t.Logf("Families of several collectors should be merged:\n%s", text)
+		t.FailNow()
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	metrics := NewMetrics("")
+	metrics.ObserveTransition("1", "1-2")
+
+	rec := httptest.NewRecorder()
+	MetricsHandler(metrics).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rec.Header().Get("Content-Type") != PrometheusContentType {
+		t.Logf("Content type is different from expected: %s", rec.Header().Get("Content-Type"))
+		t.FailNow()
+	}
+	if !strings.Contains(rec.Body.String(), "fsm_transitions_total{state=\"1\",transition=\"1-2\"} 1\n") {
+		t.Logf("Handler should expose collected metrics:\n%s", rec.Body.String())
+		t.FailNow()
+	}
+}
@@ -0,0 +1,111 @@
+package simple_fsm
+
+import (
+	"fmt"
+)
+
+// PseudoKind
+// Enum-like type describing transient states, which are passed through
+// within a single step and never become active (never appear in the stack)
+type PseudoKind int
+
+const (
+	// PseudoNone
+	// Regular state
+	PseudoNone PseudoKind = iota
+	// PseudoChoice
+	// Dynamic branch: outgoing guards are evaluated after actions
+	// of incoming transitions are executed, so they can see action results
+	// (source states are exited before that, actions write to their common ancestor)
+	PseudoChoice
+	// PseudoJunction
+	// Static branch: outgoing guards are evaluated before any action
+	// of the compound transition is executed
+	PseudoJunction
+)
+
+// NewChoice
+// Constructs choice pseudo-state (see PseudoChoice)
+// Exactly one of the transitions should be an else branch (see NewElseTransition)
+func NewChoice(name string, transitions []Transition) *StateInfo {
+	return &StateInfo{Name: name, Transitions: transitions, Pseudo: PseudoChoice}
+}
+
+// NewJunction
+// Constructs junction pseudo-state (see PseudoJunction)
+// Exactly one of the transitions should be an else branch (see NewElseTransition)
+func NewJunction(name string, transitions []Transition) *StateInfo {
+	return &StateInfo{Name: name, Transitions: transitions, Pseudo: PseudoJunction}
+}
+
+// validatePseudo
+// Checks if pseudo-state is well-formed: it can't have anything but
+// unconditional/guarded external transitions, one of them is an else branch
+func (si *StateInfo) validatePseudo() (err *FsmError) {
+	switch {
+	case si.StartSubState != nil, si.Parallel(), si.HistoryKind != HistoryNone:
+		return newFsmErrorStateIsInvalid(si, "pseudo-state can't have sub states")
+	case si.OnEnter != nil, si.OnExit != nil:
+		return newFsmErrorStateIsInvalid(si, "pseudo-state can't have entry or exit actions")
+	case len(si.Done) > 0, len(si.OnError) > 0:
+		return newFsmErrorStateIsInvalid(si, "pseudo-state can't have done or error transitions")
+	}
+
+	var branches int
+	for _, tr := range si.Transitions {
+		switch {
+		case tr.Event != "":
+			return newFsmErrorStateIsInvalid(si, "pseudo-state transitions can't be bound to an event")
+		case tr.Kind == TransitionInternal:
+			return newFsmErrorStateIsInvalid(si, "pseudo-state transitions can't be internal")
+		case tr.Else:
+			branches++
+		}
+	}
+	if branches != 1 {
+		err = newFsmErrorStateIsInvalid(si, "pseudo-state should have exactly one else transition")
+	}
+	return
+}
+
+// compound
+// Chain of transitions taken within a single step
+type compound struct {
+	transition *Transition        // transition the step has started with
+	pending    []*stackTransition // transitions which actions are not executed yet
+	path       []string           // pseudo-states and transitions passed after the first one
+	exited     []StateContext     // states popped from the stack so far
+}
+
+// passPseudo
+// Chooses outgoing transition of the pseudo-state, returns its destination
+// Choice pseudo-state exits active states and executes pending actions beforehand
+func (fsm *Fsm) passPseudo(stack *ContextStack, pseudo *StateInfo, chain *compound) (next *StateInfo, recall bool, err *FsmError) {
+	if pseudo.Pseudo == PseudoChoice {
+		if err = fsm.exit(stack, pseudo, chain); err != nil {
+			return
+		}
+		if err = fsm.runActions(stack, chain); err != nil {
+			return
+		}
+	}
+
+	tr, _, err := fsm.selectTransition(stack, pseudo, pseudo.Transitions, "")
+	switch {
+	case err != nil:
+		return
+	case tr == nil:
+		err = newFsmErrorRuntime("no branch of pseudo-state is opened", pseudo)
+		return
+	}
+
+	chain.pending = append(chain.pending, &stackTransition{Transition: tr, source: pseudo})
+	chain.path = append(chain.path, pseudo.Name, tr.Name)
+
+	name, recall := historyTarget(tr.ToState)
+	if next = fsm.structure.states[name]; next == nil {
+		cause := fmt.Sprintf("pseudo-state \"%s\" leads to unknown state \"%s\"", pseudo.Name, name)
+		err = newFsmErrorRuntime(cause, pseudo)
+	}
+	return
+}
@@ -0,0 +1,105 @@
+package simple_fsm
+
+import (
+	"testing"
+)
+
+// makePseudoStructure
+// "start" sets "amount" to 100 and goes to "check" pseudo-state,
+// which leads to "big" when amount is bigger than 50, else to "small"
+func makePseudoStructure(kind PseudoKind) *Structure {
+	setAmount := NewAction(func(ctx ContextOperator) error {
+		ctx.Put("amount", 100)
+		return nil
+	})
+	isBig := func(ctx ContextAccessor) (bool, error) {
+		amount, err := ctx.Int("amount")
+		return err == nil && amount > 50, nil
+	}
+
+	check := NewChoice("check", []Transition{
+		NewTransition("check-big", "big", isBig, nil),
+		NewElseTransition("check-small", "small", nil),
+	})
+	check.Pseudo = kind
+
+	return MakeStructure(nil,
+		NewState("start", NewTransitionAlways("start-check", "check", setAmount)),
+		check,
+		NewState("big", nil),
+		NewState("small", nil),
+	)
+}
+
+func TestFsmChoice(t *testing.T) {
+	fsm := NewFsm(makePseudoStructure(PseudoChoice))
+	fsm.Advance()
+	step, err := fsm.Advance()
+	if err != nil || step.to != "big" || !fsm.Completed() {
+		t.Logf("Choice should be resolved after incoming action within the same step, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+	if step.transition != "start-check" || len(step.path) != 2 || step.path[0] != "check" || step.path[1] != "check-big" {
+		t.Logf("History should contain full compound path: %v", step.path)
+		t.FailNow()
+	}
+	if len(fsm.History()) != 2 {
+		t.Log("Pseudo-state should not be visited as a real state")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+}
+
+func TestFsmJunction(t *testing.T) {
+	fsm := NewFsm(makePseudoStructure(PseudoJunction))
+	fsm.Advance()
+	if step, err := fsm.Advance(); err != nil || step.to != "small" || !fsm.Completed() {
+		t.Logf("Junction should be resolved before incoming action, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+	if amount, err := fsm.stack.Int("amount"); err != nil || amount != 100 {
+		t.Log("Incoming action should still be executed")
+		t.FailNow()
+	}
+}
+
+func TestStructureValidatePseudo(t *testing.T) {
+	fstr := makePseudoStructure(PseudoChoice)
+	fstr.states["check"].Transitions[1].Else = false
+	if err := fstr.Validate(); err == nil || err.Kind() != ErrStateIsInvalid {
+		t.Logf("Validation should fail (no else branch): %v", err)
+		t.FailNow()
+	}
+
+	fstr = makePseudoStructure(PseudoChoice)
+	fstr.states["big"].Transitions = []Transition{NewElseTransition("big-small", "small", nil)}
+	if err := fstr.Validate(); err == nil || err.Kind() != ErrStateIsInvalid {
+		t.Logf("Validation should fail (else branch of a regular state): %v", err)
+		t.FailNow()
+	}
+
+	fstr = makePseudoStructure(PseudoChoice)
+	fstr.AddState(NewState("nested", nil), fstr.states["check"])
+	if err := fstr.Validate(); err == nil || err.Kind() != ErrStateIsInvalid {
+		t.Logf("Validation should fail (pseudo-state is a parent): %v", err)
+		t.FailNow()
+	}
+
+	fstr = NewStructure()
+	split := NewState("split", nil)
+	fstr.AddStartState(split, nil)
+	fstr.AddRegion(NewChoice("left", []Transition{NewElseTransition("left-right", "right", nil)}), split)
+	fstr.AddRegion(NewState("right", nil), split)
+	if err := fstr.Validate(); err == nil || err.Kind() != ErrStateIsInvalid {
+		t.Logf("Validation should fail (pseudo-state is a region): %v", err)
+		t.FailNow()
+	}
+
+	fstr = NewStructure()
+	if err := fstr.AddStartState(NewJunction("junction", NewTransitionAlways("junction-1", "1", nil)), nil); err == nil {
+		t.Log("Adding a state should fail (pseudo-state without else branch)")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,400 @@
+package simple_fsm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// RecordedOp
+// Enum-like type describing FSM API call made during recorded run
+type RecordedOp string
+
+const (
+	RecordedInput      RecordedOp = "input"
+	RecordedAdvance    RecordedOp = "advance"
+	RecordedFire       RecordedOp = "fire"
+	RecordedCompensate RecordedOp = "compensate"
+	RecordedReset      RecordedOp = "reset"
+)
+
+// RecordedCallback
+// Outcome of a guard evaluation or a single action attempt
+// Guards are identified by transition and state declaring it,
+// actions by their kind (who) and transition, state or compensation name
+// Step is a number of history items made before the callback
+type RecordedCallback struct {
+	Step   int            `json:"step"`
+	Who    string         `json:"who"`
+	Name   string         `json:"name"`
+	State  string         `json:"state,omitempty"`
+	Open   bool           `json:"open,omitempty"`
+	Writes []JournalWrite `json:"writes,omitempty"`
+	Err    string         `json:"error,omitempty"`
+	Class  string         `json:"class,omitempty"`
+}
+
+// RecordedCall
+// FSM API call along with its arguments, callbacks made and outcome:
+// history items made and kind of returned error (if any)
+// Input call payload holds the single input parameter
+type RecordedCall struct {
+	Op        RecordedOp               `json:"op"`
+	Event     string                   `json:"event,omitempty"`
+	Payload   map[string]SnapshotValue `json:"payload,omitempty"`
+	Callbacks []RecordedCallback       `json:"callbacks,omitempty"`
+	Steps     []SnapshotHistoryItem    `json:"steps,omitempty"`
+	Err       *FsmErrorKind            `json:"error,omitempty"`
+}
+
+// Recording
+// Nondeterministic inputs of FSM run, enough to reproduce it (see Replay)
+// Incomplete holds the reason if some value couldn't be recorded (see ValueCodecs)
+type Recording struct {
+	Structure  string         `json:"structure"`
+	Calls      []RecordedCall `json:"calls"`
+	Incomplete string         `json:"incomplete,omitempty"`
+}
+
+// WithRecording
+// Makes FSM record its run: input parameters, API calls and callback outcomes
+// Runs interrupted by go context (see AdvanceContext) can't be replayed exactly
+func WithRecording(recording *Recording) FsmOption {
+	return func(fsm *Fsm) {
+		recording.Structure = fsm.structure.Fingerprint()
+		fsm.recording = recording
+	}
+}
+
+// replayedError
+// Error returned by recorded callback, class is preserved (see Classify)
+type replayedError struct {
+	msg   string
+	class string
+}
+
+func (re *replayedError) Error() string {
+	return re.msg
+}
+
+func (re *replayedError) Class() string {
+	return re.class
+}
+
+// replayCursor
+// Position in the recording being replayed, holds the first divergence found
+type replayCursor struct {
+	recording *Recording
+	call      int
+	callback  int
+	diverged  *FsmError
+}
+
+// errDiverged
+// Error returned by stubbed callbacks once replay has diverged
+var errDiverged = errors.New("replay diverged from recording")
+
+// Replay
+// Repeats recorded run against the structure, guards and actions are not called:
+// recorded guard results, action context writes and errors are used instead.
+// Returns FSM in the state recorded run has finished with.
+// Every callback and every call outcome is checked against the recording,
+// the first difference is reported as divergence (see ErrFsmDiverged)
+// Step times are not recorded, history items get them from the clock of replaying FSM
+func Replay(structure *Structure, recording *Recording, options ...FsmOption) (fsm *Fsm, err *FsmError) {
+	switch {
+	case recording.Incomplete != "":
+		return nil, newFsmErrorDiverged(0, 0, "complete recording", recording.Incomplete)
+	case recording.Structure != structure.Fingerprint():
+		return nil, newFsmErrorDiverged(0, 0, "structure "+recording.Structure, "structure "+structure.Fingerprint())
+	}
+
+	fsm = NewFsm(structure, options...)
+	cursor := &replayCursor{recording: recording}
+	fsm.replaying = cursor
+	defer func() { fsm.replaying = nil }()
+
+	for idx := range recording.Calls {
+		call := &recording.Calls[idx]
+		cursor.call, cursor.callback = idx, 0
+		start := len(fsm.history)
+
+		var payload map[string]interface{}
+		if payload, err = fsm.decodeValues(call.Payload); err != nil {
+			return
+		}
+
+		var e *FsmError
+		switch call.Op {
+		case RecordedInput:
+			for k, v := range payload {
+				e = fsm.SetInput(k, v)
+			}
+		case RecordedAdvance:
+			_, e = fsm.Advance()
+		case RecordedFire:
+			_, e = fsm.Fire(call.Event, payload)
+		case RecordedCompensate:
+			e = fsm.Compensate()
+		case RecordedReset:
+			// history is discarded, so is its part made before the call
+			fsm.Reset()
+			start = 0
+		default:
+			return fsm, newFsmErrorDiverged(idx, start, "known call", string(call.Op))
+		}
+
+		if cursor.diverged != nil {
+			return fsm, cursor.diverged
+		}
+		if cursor.callback < len(call.Callbacks) {
+			return fsm, newFsmErrorDiverged(idx, call.Callbacks[cursor.callback].Step,
+				call.Callbacks[cursor.callback].describe(), "no more callbacks")
+		}
+		if err = compareSteps(idx, start, call.Steps, fsm.history[start:]); err != nil {
+			return
+		}
+		if expected, actual := describeErrorKind(call.Err), describeError(e); expected != actual {
+			return fsm, newFsmErrorDiverged(idx, len(fsm.history), expected, actual)
+		}
+	}
+	return
+}
+
+// recordCall
+// Starts recording of an API call (if FSM is recording)
+// Returns a function finishing the record given error returned by the call
+func (fsm *Fsm) recordCall(op RecordedOp, event string, payload map[string]interface{}) func(*FsmError) {
+	if fsm.recording == nil {
+		return func(*FsmError) {}
+	}
+	recording := fsm.recording
+	call := RecordedCall{Op: op, Event: event}
+	call.Payload = fsm.encodeValues(payload)
+	recording.Calls = append(recording.Calls, call)
+	idx, start := len(recording.Calls)-1, len(fsm.history)
+
+	return func(err *FsmError) {
+		call := &recording.Calls[idx]
+		if err != nil {
+			kind := err.Kind()
+			call.Err = &kind
+		}
+		for _, it := range fsm.history[start:] {
+			call.Steps = append(call.Steps, SnapshotHistoryItem{
+				From:       it.from,
+				To:         it.to,
+				Transition: it.transition,
+				Event:      it.event,
+				Path:       it.path,
+			})
+		}
+	}
+}
+
+// recordCallback
+// Adds callback outcome to the call being recorded
+func (fsm *Fsm) recordCallback(callback RecordedCallback, e error) {
+	if e != nil {
+		callback.Err = e.Error()
+		var classified ClassifiedError
+		if errors.As(e, &classified) {
+			callback.Class = classified.Class()
+		}
+	}
+	if calls := fsm.recording.Calls; len(calls) > 0 {
+		last := &calls[len(calls)-1]
+		last.Callbacks = append(last.Callbacks, callback)
+	}
+}
+
+// evalGuard
+// Evaluates transition guard, recording its result or replaying the recorded one
+func (fsm *Fsm) evalGuard(stack *ContextStack, state *StateInfo, tr *Transition) (open bool, err error) {
+	callback := RecordedCallback{Step: len(fsm.history), Who: "guard", Name: tr.Name, State: state.Name}
+	switch {
+	case fsm.replaying != nil:
+		recorded := fsm.replaying.next(callback)
+		if recorded == nil {
+			return false, errDiverged
+		}
+		return recorded.Open, recorded.error()
+	case fsm.recording != nil:
+		open, err = tr.Guard(stack)
+		callback.Open = open
+		fsm.recordCallback(callback, err)
+		return
+	}
+	return tr.Guard(stack)
+}
+
+// invoke
+// Executes single action attempt, recording context members written and error
+// or replaying recorded ones
+func (fsm *Fsm) invoke(ctx ContextOperator, who string, name string, action *PackagedAction) error {
+	callback := RecordedCallback{Step: len(fsm.history), Who: who, Name: name}
+	switch {
+	case fsm.replaying != nil:
+		recorded := fsm.replaying.next(callback)
+		if recorded == nil {
+			return errDiverged
+		}
+		writes, err := fsm.decodeWrites(recorded.Writes)
+		if err == nil {
+			err = applyWrites(contextStack(ctx), writes)
+		}
+		if err != nil {
+			fsm.replaying.diverge(newFsmErrorDiverged(fsm.replaying.call, callback.Step, "replayable writes", err.Error()))
+			return errDiverged
+		}
+		if recorder, ok := ctx.(*contextRecorder); ok {
+			recorder.writes = append(recorder.writes, writes...)
+		}
+		return recorded.error()
+	case fsm.recording != nil:
+		recorder, nested := ctx.(*contextRecorder)
+		if !nested {
+			recorder = newContextRecorder(contextStack(ctx))
+		}
+		before := len(recorder.writes)
+		e := action.Do(recorder)
+
+		var err *FsmError
+		if callback.Writes, err = fsm.encodeWrites(recorder.writes[before:]); err != nil && fsm.recording.Incomplete == "" {
+			fsm.recording.Incomplete = err.Error()
+		}
+		fsm.recordCallback(callback, e)
+		return e
+	}
+	return action.Do(ctx)
+}
+
+// contextStack
+// Returns the stack action operates on
+func contextStack(ctx ContextOperator) *ContextStack {
+	if recorder, ok := ctx.(*contextRecorder); ok {
+		return recorder.ContextStack
+	}
+	return ctx.(*ContextStack)
+}
+
+// encodeValues
+// Converts call arguments to recording representation
+// Values that can't be encoded make recording incomplete
+func (fsm *Fsm) encodeValues(values map[string]interface{}) map[string]SnapshotValue {
+	if len(values) == 0 {
+		return nil
+	}
+	encoded := make(map[string]SnapshotValue, len(values))
+	for k, v := range values {
+		sv, err := fsm.codecs.encode(k, v)
+		if err != nil && fsm.recording.Incomplete == "" {
+			fsm.recording.Incomplete = err.Error()
+		}
+		encoded[k] = sv
+	}
+	return encoded
+}
+
+// decodeValues
+// Converts recorded call arguments back
+func (fsm *Fsm) decodeValues(encoded map[string]SnapshotValue) (values map[string]interface{}, err *FsmError) {
+	if encoded == nil {
+		return
+	}
+	values = make(map[string]interface{}, len(encoded))
+	for k, sv := range encoded {
+		if values[k], err = fsm.codecs.decode(k, sv); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// next
+// Returns recorded outcome of the callback about to be made,
+// nil if callback is different from recorded one (divergence is remembered)
+func (rc *replayCursor) next(actual RecordedCallback) *RecordedCallback {
+	if rc.diverged != nil {
+		return nil
+	}
+	callbacks := rc.recording.Calls[rc.call].Callbacks
+	if rc.callback >= len(callbacks) {
+		rc.diverge(newFsmErrorDiverged(rc.call, actual.Step, "no more callbacks", actual.describe()))
+		return nil
+	}
+	expected := &callbacks[rc.callback]
+	if expected.Step != actual.Step || expected.Who != actual.Who ||
+		expected.Name != actual.Name || expected.State != actual.State {
+		rc.diverge(newFsmErrorDiverged(rc.call, actual.Step, expected.describe(), actual.describe()))
+		return nil
+	}
+	rc.callback++
+	return expected
+}
+
+// diverge
+// Remembers the first divergence
+func (rc *replayCursor) diverge(err *FsmError) {
+	if rc.diverged == nil {
+		rc.diverged = err
+	}
+}
+
+// describe
+// Returns callback description for divergence reports
+func (rc *RecordedCallback) describe() string {
+	if rc.State != "" {
+		return fmt.Sprintf("%s of \"%s\" declared by \"%s\" at step %d", rc.Who, rc.Name, rc.State, rc.Step)
+	}
+	return fmt.Sprintf("%s of \"%s\" at step %d", rc.Who, rc.Name, rc.Step)
+}
+
+// error
+// Returns recorded callback error, nil if callback succeeded
+func (rc *RecordedCallback) error() error {
+	if rc.Err == "" {
+		return nil
+	}
+	return &replayedError{msg: rc.Err, class: rc.Class}
+}
+
+// compareSteps
+// Checks history items made by replayed call against recorded ones
+func compareSteps(call int, start int, expected []SnapshotHistoryItem, actual []HistoryItem) *FsmError {
+	describe := func(it SnapshotHistoryItem) string {
+		return fmt.Sprintf("step \"%s\" -> \"%s\" by \"%s\" %v", it.From, it.To, it.Transition, it.Path)
+	}
+	for idx := 0; idx < len(expected) || idx < len(actual); idx++ {
+		exp, act := "no step", "no step"
+		if idx < len(expected) {
+			exp = describe(expected[idx])
+		}
+		if idx < len(actual) {
+			it := actual[idx]
+			act = describe(SnapshotHistoryItem{From: it.from, To: it.to, Transition: it.transition, Path: it.path})
+		}
+		if exp != act {
+			return newFsmErrorDiverged(call, start+idx, exp, act)
+		}
+	}
+	return nil
+}
+
+// describeErrorKind
+// Returns recorded call error description for divergence reports
+func describeErrorKind(kind *FsmErrorKind) string {
+	if kind == nil {
+		return "no error"
+	}
+	return fmt.Sprintf("error of kind %d", *kind)
+}
+
+// describeError
+// Returns call error description for divergence reports
+func describeError(err *FsmError) string {
+	if err == nil {
+		return describeErrorKind(nil)
+	}
+	kind := err.Kind()
+	return describeErrorKind(&kind)
+}
@@ -0,0 +1,136 @@
+package simple_fsm
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordRun
+// Records the run of the structure with given amount, passes recording through JSON
+func recordRun(t *testing.T, amount int) (*Fsm, *Recording) {
+	var recording Recording
+	fsm := NewFsm(makeReplayStructure(true), WithRecording(&recording), WithClock(&fakeClock{}))
+	fsm.SetInput("amount", amount)
+	fsm.Run()
+	fsm.Fire("approve", map[string]interface{}{"by": "alice"})
+
+	raw, e := json.Marshal(recording)
+	if e != nil {
+		t.Logf("Recording should be serializable: %v", e)
+		t.FailNow()
+	}
+	var decoded Recording
+	if e = json.Unmarshal(raw, &decoded); e != nil {
+		t.Logf("Recording should be deserializable: %v", e)
+		t.FailNow()
+	}
+	return fsm, &decoded
+}
+
+func TestFsmReplay(t *testing.T) {
+	recorded, recording := recordRun(t, 500)
+	if res, err := recorded.Result(); err != nil || res != "approved by alice" {
+		t.Logf("Recorded run should complete: %v, %v", res, err)
+		t.FailNow()
+	}
+
+	replayed, err := Replay(makeReplayStructure(false), recording)
+	if err != nil {
+		t.Logf("Replay should not diverge: %v", err)
+		t.FailNow()
+	}
+	if res, err := replayed.Result(); err != nil || res != "approved by alice" {
+		t.Logf("Replay should reproduce the result: %v, %v", res, err)
+		t.FailNow()
+	}
+
+	// step times are not recorded, they come from the clock of replaying FSM
+	expected, actual := mustSnapshot(t, recorded), mustSnapshot(t, replayed)
+	for _, history := range [][]SnapshotHistoryItem{expected.History, actual.History} {
+		for idx := range history {
+			history[idx].Start, history[idx].End = time.Time{}, time.Time{}
+		}
+	}
+	rawExpected, _ := json.Marshal(expected.History)
+	rawActual, _ := json.Marshal(actual.History)
+	if string(rawExpected) != string(rawActual) {
+		t.Logf("Replay should reproduce the history:\n%s\n%s", rawExpected, rawActual)
+		t.FailNow()
+	}
+	rawExpected, _ = json.Marshal(expected.Stack)
+	rawActual, _ = json.Marshal(actual.Stack)
+	if string(rawExpected) != string(rawActual) {
+		t.Logf("Replay should reproduce contexts:\n%s\n%s", rawExpected, rawActual)
+		t.FailNow()
+	}
+}
+
+func TestFsmReplayReset(t *testing.T) {
+	var recording Recording
+	fsm := NewFsm(makeReplayStructure(true), WithRecording(&recording), WithClock(&fakeClock{}))
+	fsm.SetInput("amount", 50)
+	fsm.Advance()
+	fsm.Advance()
+	fsm.Reset()
+	fsm.Advance()
+
+	replayed, err := Replay(makeReplayStructure(false), &recording)
+	if err != nil {
+		t.Logf("Replay of reset FSM should not diverge: %v", err)
+		t.FailNow()
+	}
+	if len(replayed.History()) != 1 || replayed.History()[0].To() != "start" {
+		t.Logf("Replay should reproduce the history made after reset:\n%s", replayed.history.Dump())
+		t.FailNow()
+	}
+}
+
+func TestFsmReplayDivergence(t *testing.T) {
+	_, recording := recordRun(t, 500)
+
+	// guard of "check-big" was open, pretend it was not
+	for idx := range recording.Calls {
+		for pos, callback := range recording.Calls[idx].Callbacks {
+			if callback.Name == "check-big" {
+				recording.Calls[idx].Callbacks[pos].Open = false
+			}
+		}
+	}
+	_, err := Replay(makeReplayStructure(false), recording)
+	if err == nil || err.Kind() != ErrFsmDiverged || !strings.Contains(err.Error(), "call #3, step #2") {
+		t.Logf("Divergence should be reported at the step: %v", err)
+		t.FailNow()
+	}
+
+	_, recording = recordRun(t, 500)
+	recording.Calls[len(recording.Calls)-1].Callbacks[0].Name = "big-cancelled"
+	_, err = Replay(makeReplayStructure(false), recording)
+	if err == nil || err.Kind() != ErrFsmDiverged ||
+		!strings.Contains(err.Error(), "call #5, step #3: expected guard of \"big-cancelled\" declared by \"big\"") {
+		t.Logf("Divergence should be reported at the callback: %v", err)
+		t.FailNow()
+	}
+
+	changed := makeReplayStructure(false)
+	changed.states["small"].Transitions[0].ToState = "big"
+	if _, err = Replay(changed, recording); err == nil || err.Kind() != ErrFsmDiverged || !strings.Contains(err.Error(), "structure") {
+		t.Logf("Structure change should be reported: %v", err)
+		t.FailNow()
+	}
+}
+
+func TestFsmRecordingIncomplete(t *testing.T) {
+	var recording Recording
+	fsm := NewFsm(makeReplayStructure(true), WithRecording(&recording))
+	fsm.SetInput("amount", point{1, 2})
+	if recording.Incomplete == "" {
+		t.Log("Recording should be incomplete when a value has no codec")
+		t.FailNow()
+	}
+	if _, err := Replay(makeReplayStructure(false), &recording); err == nil || err.Kind() != ErrFsmDiverged {
+		t.Logf("Incomplete recording should not be replayed: %v", err)
+		t.FailNow()
+	}
+}
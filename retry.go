@@ -0,0 +1,167 @@
+package simple_fsm
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Backoff
+// Enum-like type describing how delay between action attempts grows
+type Backoff int
+
+const (
+	// BackoffFixed
+	// Delay is the same before every attempt
+	BackoffFixed Backoff = iota
+	// BackoffExponential
+	// Delay is doubled before every next attempt (up to MaxDelay, if set)
+	BackoffExponential
+)
+
+// RetryPolicy
+// Describes how failed action is executed again
+// MaxAttempts includes the first attempt, so 1 means no retries
+// Only errors of listed classes (see Classify) are retried,
+// empty list means any error is retried
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     Backoff
+	Delay       time.Duration
+	MaxDelay    time.Duration
+	On          []string
+}
+
+// Validate
+// Checks if retry policy is well-formed
+func (rp *RetryPolicy) Validate() (err *FsmError) {
+	switch {
+	case rp.MaxAttempts < 1:
+		err = newFsmErrorInvalid("retry policy should allow at least 1 attempt")
+	case rp.Delay < 0, rp.MaxDelay < 0:
+		err = newFsmErrorInvalid("retry policy delays can't be negative")
+	}
+	return
+}
+
+// delay
+// Returns delay before given attempt (attempts are counted from 1)
+func (rp *RetryPolicy) delay(attempt int) time.Duration {
+	delay := rp.Delay
+	if rp.Backoff == BackoffExponential {
+		for idx := 2; idx < attempt; idx++ {
+			delay *= 2
+			if rp.MaxDelay > 0 && delay >= rp.MaxDelay {
+				break
+			}
+		}
+	}
+	if rp.MaxDelay > 0 && delay > rp.MaxDelay {
+		delay = rp.MaxDelay
+	}
+	return delay
+}
+
+// retryable
+// Checks if given error is worth another attempt
+func (rp *RetryPolicy) retryable(err error) bool {
+	if len(rp.On) == 0 {
+		return true
+	}
+	var classified ClassifiedError
+	if !errors.As(err, &classified) {
+		return false
+	}
+	for _, class := range rp.On {
+		if class == classified.Class() {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassifiedError
+// Error that belongs to a named class, used to decide if failed action is retried
+type ClassifiedError interface {
+	error
+	Class() string
+}
+
+// classifiedError
+// Default ClassifiedError implementation, see Classify
+type classifiedError struct {
+	class string
+	err   error
+}
+
+func (ce *classifiedError) Error() string {
+	return fmt.Sprintf("%s: %s", ce.class, ce.err.Error())
+}
+
+func (ce *classifiedError) Class() string {
+	return ce.class
+}
+
+func (ce *classifiedError) Unwrap() error {
+	return ce.err
+}
+
+// Classify
+// Marks an error returned by action as belonging to given class
+func Classify(class string, err error) error {
+	return &classifiedError{class: class, err: err}
+}
+
+// actionAttempt
+// Outcome of a single attempt of the action with retry policy
+type actionAttempt struct {
+	who    string
+	number int
+	err    error
+}
+
+// doAction
+// Executes the action, failed attempts are repeated according to its retry policy
+// Waiting between attempts is interrupted when go context of the step is done
+// (and skipped when recorded run is replayed)
+// Attempts of actions with retry policy are collected for the history
+// Outcome of the action (see ActionOutcome) is collected for the history as well
+// Time spent on the action (all attempts included) is logged and measured (see WithLogger, Structure.SetMetrics)
+// name identifies the action: it's transition, state or compensation name
+func (fsm *Fsm) doAction(ctx ContextOperator, who string, name string, action *PackagedAction) (err error) {
+	recorder, nested := ctx.(*contextRecorder)
+	if !nested {
+		recorder = newContextRecorder(contextStack(ctx))
+		ctx = recorder
+	}
+	before := len(recorder.writes)
+
+	start := fsm.clock.Now()
+	defer func() {
+		duration := fsm.clock.Now().Sub(start)
+		fsm.logAction(who, name, duration, err)
+		fsm.observeAction(who, name, duration, err)
+		fsm.actions = append(fsm.actions, newActionOutcome(who, name, action, recorder.writes[before:], err))
+	}()
+
+	policy := action.Retry
+	if policy == nil {
+		return fsm.traceAction(ctx, who, name, 1, action)
+	}
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && fsm.replaying == nil {
+			select {
+			case <-fsm.clock.After(policy.delay(attempt)):
+			case <-GoContext(ctx).Done():
+				return GoContext(ctx).Err()
+			}
+		}
+
+		err = fsm.traceAction(ctx, who, name, attempt, action)
+		fsm.attempts = append(fsm.attempts, actionAttempt{who: who, number: attempt, err: err})
+		if err == nil || attempt >= policy.MaxAttempts || !policy.retryable(err) {
+			return
+		}
+	}
+}
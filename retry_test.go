@@ -0,0 +1,78 @@
+package simple_fsm
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	fixed := RetryPolicy{MaxAttempts: 5, Delay: time.Second}
+	if fixed.delay(2) != time.Second || fixed.delay(5) != time.Second {
+		t.Log("Fixed backoff should always wait the same")
+		t.FailNow()
+	}
+
+	exp := RetryPolicy{MaxAttempts: 5, Backoff: BackoffExponential, Delay: time.Second, MaxDelay: 3 * time.Second}
+	if exp.delay(2) != time.Second || exp.delay(3) != 2*time.Second || exp.delay(4) != 3*time.Second {
+		t.Logf("Exponential backoff should double the delay up to the limit: %v, %v, %v",
+			exp.delay(2), exp.delay(3), exp.delay(4))
+		t.FailNow()
+	}
+
+	if (&RetryPolicy{}).Validate() == nil || (&RetryPolicy{MaxAttempts: 1, Delay: -1}).Validate() == nil {
+		t.Log("Policy without attempts or with negative delay should be invalid")
+		t.FailNow()
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	plain := errors.New("boom")
+	busy := Classify("busy", plain)
+
+	if !(&RetryPolicy{}).retryable(plain) {
+		t.Log("Any error should be retried if classes are not specified")
+		t.FailNow()
+	}
+	policy := RetryPolicy{On: []string{"busy"}}
+	if policy.retryable(plain) || !policy.retryable(busy) {
+		t.Log("Only errors of listed classes should be retried")
+		t.FailNow()
+	}
+	if !errors.Is(busy, plain) {
+		t.Log("Classified error should wrap the original one")
+		t.FailNow()
+	}
+}
+
+func TestFsmActionRetry(t *testing.T) {
+	clock := &fakeClock{}
+	fsm := NewFsm(makeRetryStructure(2, "busy"), WithClock(clock))
+	if fsm.Run(); !fsm.Completed() {
+		t.Log("Action should succeed on the last attempt")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+	if len(clock.delays) != 2 || clock.delays[0] != 10*time.Millisecond || clock.delays[1] != 20*time.Millisecond {
+		t.Logf("FSM should wait between attempts according to backoff: %v", clock.delays)
+		t.FailNow()
+	}
+	attempts := fsm.History()[1].attempts
+	if len(attempts) != 3 || attempts[0].err == nil || attempts[2].err != nil || attempts[2].number != 3 {
+		t.Logf("Every attempt should be logged: %v", attempts)
+		t.FailNow()
+	}
+
+	fsm = NewFsm(makeRetryStructure(3, "busy"), WithClock(&fakeClock{}))
+	if _, err := fsm.Run(); err == nil || !fsm.Fatal() || len(fsm.History()[1].attempts) != 3 {
+		t.Logf("FSM should go fatal when attempts are exhausted, error: %v", err)
+		t.FailNow()
+	}
+
+	clock = &fakeClock{}
+	fsm = NewFsm(makeRetryStructure(1, "broken"), WithClock(clock))
+	if fsm.Run(); !fsm.Fatal() || len(clock.delays) != 0 {
+		t.Log("Errors of unlisted classes should not be retried")
+		t.FailNow()
+	}
+}
@@ -0,0 +1,446 @@
+package simple_fsm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	FsmSnapshotVersion = 1
+)
+
+// SnapshotValue
+// Context value encoded by a codec (see ValueCodecs)
+type SnapshotValue struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// SnapshotState
+// Active (or remembered) state along with its context members
+// and stacks of its orthogonal regions
+type SnapshotState struct {
+	State   string                   `json:"state"`
+	Context map[string]SnapshotValue `json:"context,omitempty"`
+	Regions [][]SnapshotState        `json:"regions,omitempty"`
+}
+
+// SnapshotAttempt
+// Logged attempt of an action with retry policy
+type SnapshotAttempt struct {
+	Who    string `json:"who"`
+	Number int    `json:"number"`
+	Err    string `json:"error,omitempty"`
+}
+
+// SnapshotUndo
+// Reference to a pending compensating action:
+// compensation of state entry if transition is empty,
+// compensation of a transition declared by the state otherwise
+type SnapshotUndo struct {
+	State      string `json:"state"`
+	Transition string `json:"transition,omitempty"`
+}
+
+// SnapshotGuard
+// Guard evaluated during the step (see GuardOutcome)
+type SnapshotGuard struct {
+	State      string `json:"state"`
+	Transition string `json:"transition"`
+	Open       bool   `json:"open,omitempty"`
+	Err        string `json:"error,omitempty"`
+}
+
+// SnapshotAction
+// Action executed during the step (see ActionOutcome)
+// Parameters that can't be encoded (see ValueCodecs) are left out
+type SnapshotAction struct {
+	Who     string                   `json:"who"`
+	Name    string                   `json:"name"`
+	Params  map[string]SnapshotValue `json:"params,omitempty"`
+	Written []string                 `json:"written,omitempty"`
+	Err     string                   `json:"error,omitempty"`
+}
+
+// SnapshotHistoryItem
+// Step made by FSM
+type SnapshotHistoryItem struct {
+	From       string            `json:"from"`
+	To         string            `json:"to"`
+	Transition string            `json:"transition"`
+	Event      string            `json:"event,omitempty"`
+	Path       []string          `json:"path,omitempty"`
+	Start      time.Time         `json:"start"`
+	End        time.Time         `json:"end"`
+	Guards     []SnapshotGuard   `json:"guards,omitempty"`
+	Actions    []SnapshotAction  `json:"actions,omitempty"`
+	Err        string            `json:"error,omitempty"`
+	Attempts   []SnapshotAttempt `json:"attempts,omitempty"`
+	Undo       []SnapshotUndo    `json:"undo,omitempty"`
+}
+
+// SnapshotError
+// Fatal error FSM has stopped with
+type SnapshotError struct {
+	Kind        FsmErrorKind `json:"kind"`
+	Description string       `json:"description"`
+}
+
+// SnapshotCompensation
+// Outcome of executed compensating action (see CompensationOutcome)
+type SnapshotCompensation struct {
+	Step int    `json:"step"`
+	Name string `json:"name"`
+	Err  string `json:"error,omitempty"`
+}
+
+// Snapshot
+// Serializable FSM run-time state, can be taken between steps (see Fsm.Snapshot)
+// and used to continue the run later (see RestoreFsm)
+// Structure holds fingerprint of FSM structure, snapshot is restored
+// only with the same structure (see Structure.Fingerprint)
+type Snapshot struct {
+	Version       int                        `json:"version"`
+	Structure     string                     `json:"structure"`
+	Stack         []SnapshotState            `json:"stack"`
+	Memory        map[string][]SnapshotState `json:"memory,omitempty"`
+	History       []SnapshotHistoryItem      `json:"history"`
+	Undo          []SnapshotUndo             `json:"undo,omitempty"`
+	Compensations []SnapshotCompensation     `json:"compensations,omitempty"`
+	Fatal         *SnapshotError             `json:"fatal,omitempty"`
+}
+
+// Snapshot
+// Captures active states, their contexts, history and fatal error (if any)
+// Context values are encoded with FSM value codecs (see WithValueCodecs)
+// FSM options are not captured, they're given again on restore
+func (fsm *Fsm) Snapshot() (snapshot *Snapshot, err *FsmError) {
+	snap := Snapshot{
+		Version:   FsmSnapshotVersion,
+		Structure: fsm.structure.Fingerprint(),
+		Undo:      snapshotUndo(fsm.undo),
+	}
+
+	if snap.Stack, err = fsm.snapshotStack(&fsm.stack); err != nil {
+		return
+	}
+
+	if len(fsm.memory) > 0 {
+		snap.Memory = make(map[string][]SnapshotState, len(fsm.memory))
+		for name, memory := range fsm.memory {
+			elems := make([]SnapshotState, 0, len(memory))
+			for idx := range memory {
+				var elem SnapshotState
+				if elem, err = fsm.snapshotState(&memory[idx]); err != nil {
+					return
+				}
+				elems = append(elems, elem)
+			}
+			snap.Memory[name] = elems
+		}
+	}
+
+	snap.History = make([]SnapshotHistoryItem, 0, len(fsm.history))
+	for _, it := range fsm.history {
+		item := SnapshotHistoryItem{
+			From:       it.from,
+			To:         it.to,
+			Transition: it.transition,
+			Event:      it.event,
+			Path:       it.path,
+			Start:      it.start,
+			End:        it.end,
+			Err:        errorString(it.err),
+			Undo:       snapshotUndo(it.undo),
+		}
+		for _, guard := range it.guards {
+			item.Guards = append(item.Guards, SnapshotGuard{guard.State, guard.Transition, guard.Open, errorString(guard.Err)})
+		}
+		for _, action := range it.actions {
+			item.Actions = append(item.Actions, fsm.snapshotAction(action))
+		}
+		for _, attempt := range it.attempts {
+			item.Attempts = append(item.Attempts, SnapshotAttempt{attempt.who, attempt.number, errorString(attempt.err)})
+		}
+		snap.History = append(snap.History, item)
+	}
+
+	for _, outcome := range fsm.compensations {
+		snap.Compensations = append(snap.Compensations, SnapshotCompensation{outcome.Step, outcome.Name, errorString(outcome.Err)})
+	}
+	if fsm.fatal != nil {
+		snap.Fatal = &SnapshotError{Kind: fsm.fatal.kind, Description: fsm.fatal.description}
+	}
+
+	snapshot = &snap
+	return
+}
+
+// RestoreFsm
+// Constructs state machine continuing the run captured by the snapshot
+// Snapshot is checked against the structure: it should have the same fingerprint
+// and active states should form a valid hierarchy. State entry actions are not executed
+func RestoreFsm(structure *Structure, snapshot *Snapshot, options ...FsmOption) (fsm *Fsm, err *FsmError) {
+	switch {
+	case snapshot == nil:
+		return nil, newFsmErrorSnapshot("snapshot is nil")
+	case snapshot.Version != FsmSnapshotVersion:
+		return nil, newFsmErrorSnapshot(fmt.Sprintf("unsupported snapshot version %d", snapshot.Version))
+	case snapshot.Structure != structure.Fingerprint():
+		return nil, newFsmErrorSnapshot("snapshot was taken with a different structure")
+	case len(snapshot.Stack) == 0 || snapshot.Stack[0].State != structure.start.Name:
+		return nil, newFsmErrorSnapshot("snapshot stack should start with the global state")
+	}
+
+	restored := NewFsm(structure, options...)
+	restored.stack = newContextStack()
+	if err = restored.restoreStack(&restored.stack, snapshot.Stack, nil); err != nil {
+		return
+	}
+
+	for name, elems := range snapshot.Memory {
+		owner, present := structure.states[name]
+		if !present || owner.HistoryKind == HistoryNone {
+			return nil, newFsmErrorSnapshot(fmt.Sprintf("state \"%s\" can't have history", name))
+		}
+		var memory stateMemory
+		for _, elem := range elems {
+			var sc StateContext
+			if sc, err = restored.restoreState(elem); err != nil {
+				return
+			}
+			memory = append(memory, sc)
+		}
+		restored.memory[name] = memory
+	}
+
+	for _, item := range snapshot.History {
+		for _, name := range []string{item.From, item.To} {
+			if _, present := structure.states[name]; !present {
+				return nil, newFsmErrorSnapshot(fmt.Sprintf("history refers to unknown state \"%s\"", name))
+			}
+		}
+		it := HistoryItem{
+			number:     len(restored.history),
+			from:       item.From,
+			to:         item.To,
+			transition: item.Transition,
+			event:      item.Event,
+			path:       item.Path,
+			start:      item.Start,
+			end:        item.End,
+			err:        stringError(item.Err),
+		}
+		for _, guard := range item.Guards {
+			it.guards = append(it.guards, GuardOutcome{guard.State, guard.Transition, guard.Open, stringError(guard.Err)})
+		}
+		for _, action := range item.Actions {
+			var outcome ActionOutcome
+			if outcome, err = restored.restoreAction(action); err != nil {
+				return
+			}
+			it.actions = append(it.actions, outcome)
+		}
+		for _, attempt := range item.Attempts {
+			it.attempts = append(it.attempts, actionAttempt{attempt.Who, attempt.Number, stringError(attempt.Err)})
+		}
+		if it.undo, err = restored.restoreUndo(item.Undo); err != nil {
+			return
+		}
+		restored.history = append(restored.history, it)
+	}
+	restored.loops.replay(restored.history)
+
+	if restored.undo, err = restored.restoreUndo(snapshot.Undo); err != nil {
+		return
+	}
+	for _, outcome := range snapshot.Compensations {
+		restored.compensations = append(restored.compensations,
+			CompensationOutcome{outcome.Step, outcome.Name, stringError(outcome.Err)})
+	}
+	if snapshot.Fatal != nil {
+		restored.fatal = &FsmError{kind: snapshot.Fatal.Kind, description: snapshot.Fatal.Description}
+	}
+
+	fsm = restored
+	return
+}
+
+// snapshotStack
+// Captures states of given (root or region) stack, bottom first
+func (fsm *Fsm) snapshotStack(stack *ContextStack) (elems []SnapshotState, err *FsmError) {
+	elems = make([]SnapshotState, 0, stack.Depth())
+	for idx := range stack.stack {
+		sc := &stack.stack[idx]
+		var elem SnapshotState
+		if elem, err = fsm.snapshotState(sc); err != nil {
+			return
+		}
+		for _, region := range sc.regions {
+			var regionElems []SnapshotState
+			if regionElems, err = fsm.snapshotStack(region); err != nil {
+				return
+			}
+			elem.Regions = append(elem.Regions, regionElems)
+		}
+		elems = append(elems, elem)
+	}
+	return
+}
+
+// snapshotState
+// Captures state name and encoded context members
+func (fsm *Fsm) snapshotState(sc *StateContext) (elem SnapshotState, err *FsmError) {
+	elem.State = sc.state.Name
+	if len(sc.context.members) == 0 {
+		return
+	}
+	elem.Context = make(map[string]SnapshotValue, len(sc.context.members))
+	for k, v := range sc.context.members {
+		if elem.Context[k], err = fsm.codecs.encode(k, v); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// restoreStack
+// Pushes captured states to given (root or region) stack, checking that each one
+// is a sub state of the previous one. Region stack should start with the region itself
+func (fsm *Fsm) restoreStack(stack *ContextStack, elems []SnapshotState, region *StateInfo) *FsmError {
+	if region != nil && len(elems) == 0 {
+		return newFsmErrorSnapshot(fmt.Sprintf("region \"%s\" has no active states", region.Name))
+	}
+	for idx, elem := range elems {
+		sc, err := fsm.restoreState(elem)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case idx == 0 && region != nil && sc.state != region:
+			return newFsmErrorSnapshot(fmt.Sprintf("region \"%s\" is expected, got \"%s\"", region.Name, elem.State))
+		case idx > 0 && sc.state.Parent != stack.Peek().state:
+			return newFsmErrorSnapshot(fmt.Sprintf("\"%s\" is not a sub state of \"%s\"", elem.State, stack.Peek().state.Name))
+		case len(elem.Regions) != len(sc.state.Regions):
+			return newFsmErrorSnapshot(fmt.Sprintf("state \"%s\" has %d regions, got %d",
+				elem.State, len(sc.state.Regions), len(elem.Regions)))
+		}
+
+		stack.stack = append(stack.stack, sc)
+		head := stack.Peek()
+		for pos, regionElems := range elem.Regions {
+			regionStack := newRegionStack(stack)
+			head.regions = append(head.regions, regionStack)
+			if err = fsm.restoreStack(regionStack, regionElems, sc.state.Regions[pos]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restoreState
+// Looks up captured state in the structure and decodes its context
+func (fsm *Fsm) restoreState(elem SnapshotState) (sc StateContext, err *FsmError) {
+	state, present := fsm.structure.states[elem.State]
+	if !present {
+		err = newFsmErrorSnapshot(fmt.Sprintf("unknown state \"%s\"", elem.State))
+		return
+	}
+	sc = newStateContext(state)
+	for k, sv := range elem.Context {
+		var value interface{}
+		if value, err = fsm.codecs.decode(k, sv); err != nil {
+			return
+		}
+		sc.context.Put(k, value)
+	}
+	return
+}
+
+// restoreUndo
+// Looks up referenced compensating actions in the structure
+func (fsm *Fsm) restoreUndo(refs []SnapshotUndo) (undo []compensation, err *FsmError) {
+	for _, ref := range refs {
+		state, present := fsm.structure.states[ref.State]
+		if !present {
+			err = newFsmErrorSnapshot(fmt.Sprintf("compensation refers to unknown state \"%s\"", ref.State))
+			return
+		}
+
+		comp := compensation{name: state.Name, action: state.Compensation}
+		if ref.Transition != "" {
+			comp = compensation{name: ref.Transition, source: state}
+			for _, tr := range state.allTransitions() {
+				if tr.Name == ref.Transition && tr.Compensation != nil {
+					comp.action = tr.Compensation
+					break
+				}
+			}
+		}
+		if comp.action == nil {
+			err = newFsmErrorSnapshot(fmt.Sprintf("state \"%s\" has no compensation \"%s\"", ref.State, ref.Transition))
+			return
+		}
+		undo = append(undo, comp)
+	}
+	return
+}
+
+// snapshotUndo
+// Captures references to pending compensating actions
+func snapshotUndo(undo []compensation) (refs []SnapshotUndo) {
+	for _, comp := range undo {
+		pending := comp.pending()
+		refs = append(refs, SnapshotUndo{pending.State, pending.Transition})
+	}
+	return
+}
+
+// snapshotAction
+// Converts action outcome to snapshot representation
+func (fsm *Fsm) snapshotAction(action ActionOutcome) SnapshotAction {
+	snap := SnapshotAction{Who: action.Who, Name: action.Name, Written: action.Written, Err: errorString(action.Err)}
+	for k, v := range action.Params {
+		value, err := fsm.codecs.encode(k, v)
+		if err != nil {
+			continue
+		}
+		if snap.Params == nil {
+			snap.Params = make(map[string]SnapshotValue, len(action.Params))
+		}
+		snap.Params[k] = value
+	}
+	return snap
+}
+
+// restoreAction
+// Reverts snapshotAction
+func (fsm *Fsm) restoreAction(snap SnapshotAction) (action ActionOutcome, err *FsmError) {
+	action = ActionOutcome{Who: snap.Who, Name: snap.Name, Written: snap.Written, Err: stringError(snap.Err)}
+	if action.Params, err = fsm.decodeValues(snap.Params); err != nil {
+		err = newFsmErrorSnapshot(err.Error())
+	}
+	return
+}
+
+// errorString
+// Returns error message, empty string for nil error
+func errorString(e error) string {
+	if e == nil {
+		return ""
+	}
+	return e.Error()
+}
+
+// stringError
+// Reverts errorString, empty message means no error
+func stringError(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	return errors.New(msg)
+}
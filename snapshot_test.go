@@ -0,0 +1,218 @@
+package simple_fsm
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFsmSnapshotHistory(t *testing.T) {
+	fsm := NewFsm(makeHistoryStructure(HistoryDeep, true))
+	fsm.Advance()
+	for _, event := range []string{"next", "next", "pause"} {
+		fsm.Fire(event, nil)
+	}
+
+	restored := roundTrip(t, fsm)
+	if !restored.Running() || restored.stack.Peek().state.Name != "paused" || len(restored.History()) != len(fsm.History()) {
+		t.Log("Restored FSM should continue from the same state")
+		t.Log(Dump(restored))
+		t.FailNow()
+	}
+
+	if _, err := restored.Fire("resume", nil); err != nil || restored.stack.Peek().state.Name != "inner2" {
+		t.Logf("Remembered states should be restored, error: %v", err)
+		t.Log(Dump(restored))
+		t.FailNow()
+	}
+	if visited, err := restored.stack.Bool("visited"); err != nil || !visited {
+		t.Log("Remembered contexts should be restored")
+		t.FailNow()
+	}
+}
+
+func TestFsmSnapshotRegions(t *testing.T) {
+	var trace []string
+	fsm := NewFsm(makeParallelStructure(&trace))
+	fsm.Run()
+
+	restored := roundTrip(t, fsm)
+	regions := restored.stack.Peek().regions
+	if len(regions) != 2 || regions[0].Peek().state.Name != "unpaid" || regions[1].Peek().state.Name != "shipped" {
+		t.Log("Region stacks should be restored")
+		t.Log(Dump(restored))
+		t.FailNow()
+	}
+	if regions[0].parent != &restored.stack {
+		t.Log("Region stacks should be linked to the restored stack")
+		t.FailNow()
+	}
+
+	if _, err := restored.Fire("pay", nil); err != nil {
+		t.Logf("Restored regions should handle events: %v", err)
+		t.FailNow()
+	}
+	if restored.Run(); !restored.Completed() {
+		t.Log("Restored FSM should complete")
+		t.Log(Dump(restored))
+		t.FailNow()
+	}
+}
+
+type point struct {
+	X, Y int
+}
+
+func TestFsmSnapshotValues(t *testing.T) {
+	fstr := MakeStructure(nil,
+		NewState("1", NewTransitionAlways("1-2", "2", nil)),
+		NewState("2", nil),
+	)
+	fsm := NewFsm(fstr)
+	fsm.SetInput("count", 42)
+	fsm.SetInput("cause", errors.New("boom"))
+	fsm.SetInput("nothing", nil)
+	fsm.SetInput("where", point{1, 2})
+
+	if _, err := fsm.Snapshot(); err == nil || err.Kind() != ErrFsmSnapshot {
+		t.Logf("Values without codecs should not be captured: %v", err)
+		t.FailNow()
+	}
+
+	codecs := NewValueCodecs()
+	codecs.Register("point", point{}, NewJsonCodec(point{}))
+	fsm = NewFsm(fstr, WithValueCodecs(codecs))
+	fsm.SetInput("count", 42)
+	fsm.SetInput("cause", errors.New("boom"))
+	fsm.SetInput("nothing", nil)
+	fsm.SetInput("where", point{1, 2})
+
+	restored := roundTrip(t, fsm, WithValueCodecs(codecs))
+	if !restored.Idle() {
+		t.Log("Idle FSM should be restored as idle")
+		t.FailNow()
+	}
+	if count, err := restored.stack.Int("count"); err != nil || count != 42 {
+		t.Logf("Value types should be preserved: %v", err)
+		t.FailNow()
+	}
+	if where, err := restored.stack.Raw("where"); err != nil || where != (point{1, 2}) {
+		t.Logf("Custom values should be decoded by registered codec: %v", where)
+		t.FailNow()
+	}
+	if cause, err := restored.stack.Raw("cause"); err != nil || cause.(error).Error() != "boom" {
+		t.Logf("Errors should be restored: %v", cause)
+		t.FailNow()
+	}
+	if nothing, err := restored.stack.Raw("nothing"); err != nil || nothing != nil {
+		t.Logf("Nil values should be restored: %v", nothing)
+		t.FailNow()
+	}
+
+	if _, err := RestoreFsm(fstr, mustSnapshot(t, fsm)); err == nil || err.Kind() != ErrFsmSnapshot {
+		t.Log("Values of unknown codecs should not be restored")
+		t.FailNow()
+	}
+}
+
+func TestFsmSnapshotFatal(t *testing.T) {
+	var log []string
+	fsm := NewFsm(makeSagaStructure(&log, true, false))
+	fsm.Run()
+
+	restored := roundTrip(t, fsm)
+	if !restored.Fatal() || restored.fatal.Error() != fsm.fatal.Error() {
+		t.Log("Fatal error should be restored")
+		t.FailNow()
+	}
+	if len(restored.Compensations()) != len(fsm.Compensations()) {
+		t.Logf("Compensation outcomes should be restored: %v", restored.Compensations())
+		t.FailNow()
+	}
+
+	fsm = NewFsm(makeSagaStructure(&log, false, false))
+	fsm.Advance()
+	fsm.Advance()
+	fsm.Advance()
+	restored = roundTrip(t, fsm)
+	log = nil
+	if err := restored.Compensate(); err != nil || len(log) != 2 || log[0] != "refund" || log[1] != "release" {
+		t.Logf("Pending compensations should be restored: %v", log)
+		t.FailNow()
+	}
+}
+
+func TestFsmSnapshotMismatch(t *testing.T) {
+	var log []string
+	fsm := NewFsm(makeSagaStructure(&log, false, false))
+	fsm.Advance()
+	snapshot := mustSnapshot(t, fsm)
+
+	other := MakeStructure(nil, NewState("1", nil))
+	if _, err := RestoreFsm(other, snapshot); err == nil || err.Kind() != ErrFsmSnapshot {
+		t.Log("Snapshot should not be restored with different structure")
+		t.FailNow()
+	}
+	if makeSagaStructure(&log, true, true).Fingerprint() != fsm.structure.Fingerprint() {
+		t.Log("Fingerprint should not depend on actions")
+		t.FailNow()
+	}
+
+	snapshot.Stack = append(snapshot.Stack, SnapshotState{State: "2"})
+	if _, err := RestoreFsm(fsm.structure, snapshot); err == nil || err.Kind() != ErrFsmSnapshot {
+		t.Log("Snapshot with broken hierarchy should not be restored")
+		t.FailNow()
+	}
+
+	snapshot = mustSnapshot(t, fsm)
+	snapshot.History[0].Undo = []SnapshotUndo{{State: "1", Transition: "1-2"}}
+	if _, err := RestoreFsm(fsm.structure, snapshot); err == nil || err.Kind() != ErrFsmSnapshot {
+		t.Log("Snapshot referring to missing compensation should not be restored")
+		t.FailNow()
+	}
+}
+
+func TestFsmSnapshotLoadedFingerprint(t *testing.T) {
+	rawJson := []byte(`
+	{
+		"states": {
+			"checkout": {
+				"start": true,
+				"regions": {
+					"shipping": {"startsub": "packing"},
+					"invoicing": {"startsub": "drafted"},
+					"payment": {"startsub": "unpaid"}
+				}
+			},
+			"unpaid": {"parent": "payment", "transitions": {"unpaid-paid": {"to": "paid"}}},
+			"paid": {"parent": "payment"},
+			"packing": {"parent": "shipping"},
+			"drafted": {"parent": "invoicing"}
+		}
+	}`)
+	load := func() *Structure {
+		fstr, err := NewBuilder(ActionMap{}).FromRawJson(rawJson).Structure()
+		if err != nil {
+			t.Logf("Structure construction failed, %s", err.Error())
+			t.FailNow()
+		}
+		return fstr
+	}
+
+	fsm := NewFsm(load())
+	fsm.Advance()
+	fsm.Advance()
+	snapshot := mustSnapshot(t, fsm)
+
+	// map iteration order is random, so several loads are made
+	for i := 0; i < 20; i++ {
+		fstr := load()
+		if fstr.Fingerprint() != snapshot.Structure {
+			t.Log("Fingerprint of the same json should not change between loads")
+			t.FailNow()
+		}
+		if _, err := RestoreFsm(fstr, snapshot); err != nil {
+			t.Logf("Snapshot should be restored with structure loaded again: %s", err.Error())
+			t.FailNow()
+		}
+	}
+}
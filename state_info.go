@@ -7,19 +7,83 @@ import (
 )
 
 // StateInfo
-// Encapsulates state meta information, including entry action,
+// Encapsulates state meta information, including entry/exit actions,
 // relative hierarchy and list of outgoing transitions
+// OnEnter is executed right after state is pushed to the context stack,
+// OnExit - right before it is popped from there
+// Parallel state has several orthogonal Regions (substates with their own
+// start substates), which progress independently while the state is active.
+// Done transitions are taken when all regions reach their final states (join),
+// or, for composite state, when its active sub state is final.
+// Only final state directly under the global state completes the FSM
+// Composite state with HistoryKind set remembers its active sub states on exit
+// and can be re-entered via "<name>#history" transition destination,
+// HistoryContext makes it remember (and restore) sub state contexts as well
+// Pseudo-states (see PseudoKind) only have transitions and are never entered
+// Compensation undoes the effect of entering the state (see Fsm.Compensate)
+// OnError transitions are taken when a guard or an action fails while the state
+// (or any of its sub states without own opened error transitions) is active
 type StateInfo struct {
-	Name          string
-	Parent        *StateInfo
-	StartSubState *StateInfo
-	Transitions   []Transition
+	Name           string
+	Parent         *StateInfo
+	StartSubState  *StateInfo
+	Regions        []*StateInfo
+	Transitions    []Transition
+	Done           []Transition
+	OnError        []Transition
+	OnEnter        *PackagedAction
+	OnExit         *PackagedAction
+	Compensation   *PackagedAction
+	HistoryKind    HistoryKind
+	HistoryContext bool
+	Pseudo         PseudoKind
 }
 
 // NewState
 // Constructs state object
 func NewState(name string, transitions []Transition) *StateInfo {
-	return &StateInfo{name, nil, nil, transitions}
+	return &StateInfo{Name: name, Transitions: transitions}
+}
+
+// Entry
+// Sets state entry action
+// Returns state pointer, so calls can be chained
+func (si *StateInfo) Entry(action *PackagedAction) *StateInfo {
+	si.OnEnter = action
+	return si
+}
+
+// Exit
+// Sets state exit action
+// Returns state pointer, so calls can be chained
+func (si *StateInfo) Exit(action *PackagedAction) *StateInfo {
+	si.OnExit = action
+	return si
+}
+
+// WithCompensation
+// Sets action that undoes the effect of entering the state
+// Returns state pointer, so calls can be chained
+func (si *StateInfo) WithCompensation(action *PackagedAction) *StateInfo {
+	si.Compensation = action
+	return si
+}
+
+// Catch
+// Sets error transitions of the state
+// Returns state pointer, so calls can be chained
+func (si *StateInfo) Catch(transitions []Transition) *StateInfo {
+	si.OnError = transitions
+	return si
+}
+
+// Remember
+// Enables history pseudo-state of the composite state
+// Returns state pointer, so calls can be chained
+func (si *StateInfo) Remember(kind HistoryKind, context bool) *StateInfo {
+	si.HistoryKind = kind
+	si.HistoryContext = context
+	return si
 }
 
 // addSubState
@@ -33,28 +97,70 @@ func (si *StateInfo) addSubState(sub *StateInfo, start bool) (err *FsmError) {
 		err = newFsmErrorStateIsInvalid(sub, "Parent state already has start sub state defined")
 		return
 	}
+	if si.Parallel() {
+		err = newFsmErrorStateIsInvalid(si, "Parallel state can only have regions as sub states")
+		return
+	}
 
 	sub.Parent = si
 	if start {
 		si.StartSubState = sub
+	}
+	return
+}
 
-		if len(si.Transitions) > 0 {
-			err = newFsmErrorStateIsInvalid(si, `Start transition can't be used on
-				parent with transitions defined, it'll lead to discarding original
-				transitions`,
-			)
-			return
-		}
-		trName := fmt.Sprintf("Always %s->%s", si.Name, sub.Name)
-		si.Transitions = NewTransitionAlways(trName, sub.Name, nil)
+// startTransition
+// Constructs unconditional transition to start sub state,
+// which is taken when composite state itself is at the head of the stack
+func (si *StateInfo) startTransition() Transition {
+	return Transition{
+		Name:    fmt.Sprintf("Always %s->%s", si.Name, si.StartSubState.Name),
+		ToState: si.StartSubState.Name,
+		Guard:   guardAlways,
 	}
+}
+
+// addRegion
+// Links given region state with a parallel state
+func (si *StateInfo) addRegion(region *StateInfo) (err *FsmError) {
+	if region.Parent != nil {
+		err = newFsmErrorStateIsInvalid(region, "Region already has a parent")
+		return
+	}
+	if si.StartSubState != nil {
+		err = newFsmErrorStateIsInvalid(si, "State with start sub state can't have regions")
+		return
+	}
+
+	region.Parent = si
+	si.Regions = append(si.Regions, region)
 	return
 }
 
+// Parallel
+// Checks if state has orthogonal regions
+func (si *StateInfo) Parallel() bool {
+	return len(si.Regions) > 0
+}
+
+// region
+// Returns the closest region state containing given state (itself included)
+// or nil if the state doesn't belong to any region
+func (si *StateInfo) region() *StateInfo {
+	for curr := si; curr.Parent != nil; curr = curr.Parent {
+		for _, region := range curr.Parent.Regions {
+			if region == curr {
+				return curr
+			}
+		}
+	}
+	return nil
+}
+
 // newSubState
 // Constructs child state, links it with a parent
 func (si *StateInfo) newSubState(name string, transitions []Transition, start bool) (sub *StateInfo, err *FsmError) {
-	sub = &StateInfo{name, nil, nil, transitions}
+	sub = NewState(name, transitions)
 	err = si.addSubState(sub, start)
 	return
 }
@@ -98,9 +204,29 @@ func (si *StateInfo) Validate() (err *FsmError) {
 		err = newFsmErrorStateIsInvalid(si, "state should be named")
 	case si.checkHierarchyCycled():
 		err = newFsmErrorStateIsInvalid(si, "state hierarchy is cycled")
-	case !si.Final():
-		for idx := range si.Transitions {
-			if err = si.Transitions[idx].Validate(); err != nil {
+	case si.OnEnter != nil && si.OnEnter.Validate() != nil:
+		err = newFsmErrorStateIsInvalid(si, "entry action is invalid")
+	case si.OnExit != nil && si.OnExit.Validate() != nil:
+		err = newFsmErrorStateIsInvalid(si, "exit action is invalid")
+	case si.Compensation != nil && si.Compensation.Validate() != nil:
+		err = newFsmErrorStateIsInvalid(si, "compensation action is invalid")
+	case si.Pseudo != PseudoNone:
+		err = si.validatePseudo()
+	}
+	if err == nil {
+		for _, tr := range si.allTransitions() {
+			if err = tr.Validate(); err != nil {
+				return
+			}
+			if tr.Else && si.Pseudo == PseudoNone {
+				return newFsmErrorStateIsInvalid(si, "only pseudo-states can have else transitions")
+			}
+		}
+	}
+	if err == nil {
+		for _, region := range si.Regions {
+			if region.StartSubState == nil {
+				err = newFsmErrorStateIsInvalid(region, "region should have start sub state")
 				break
 			}
 		}
@@ -108,6 +234,17 @@ func (si *StateInfo) Validate() (err *FsmError) {
 	return
 }
 
+// ancestorOf
+// Checks if the state is an ancestor (not the state itself) of given one
+func (si *StateInfo) ancestorOf(other *StateInfo) bool {
+	for curr := other.Parent; curr != nil; curr = curr.Parent {
+		if curr == si {
+			return true
+		}
+	}
+	return false
+}
+
 // checkHierarchyCycled
 // Check if there's a cycle in parent-child relations
 // from botton to the top
@@ -125,10 +262,21 @@ func (si *StateInfo) checkHierarchyCycled() bool {
 	return false
 }
 
+// allTransitions
+// Returns regular, done and error transitions of the state
+func (si *StateInfo) allTransitions() []Transition {
+	all := make([]Transition, 0, len(si.Transitions)+len(si.Done)+len(si.OnError))
+	all = append(all, si.Transitions...)
+	all = append(all, si.Done...)
+	return append(all, si.OnError...)
+}
+
 // Final
 // Checks if state if final e.g. has no outgoing transitions
+// Parallel state without done transitions is final once all its regions are,
+// composite state with start sub state is never final
 func (si *StateInfo) Final() bool {
-	return len(si.Transitions) <= 0
+	return len(si.Transitions) <= 0 && len(si.Done) <= 0 && si.StartSubState == nil
 }
 
 // dump
@@ -152,6 +300,38 @@ func (si *StateInfo) dump(buf *bytes.Buffer, indent int) {
 		buf.WriteString(si.StartSubState.Name)
 		buf.WriteString("\"")
 	}
+	if si.Parallel() {
+		buf.WriteString(", regions: ")
+		for idx, region := range si.Regions {
+			if idx > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString("\"")
+			buf.WriteString(region.Name)
+			buf.WriteString("\"")
+		}
+	}
+	switch si.Pseudo {
+	case PseudoChoice:
+		buf.WriteString(", choice")
+	case PseudoJunction:
+		buf.WriteString(", junction")
+	}
+	switch si.HistoryKind {
+	case HistoryShallow:
+		buf.WriteString(", shallow history")
+	case HistoryDeep:
+		buf.WriteString(", deep history")
+	}
+	if si.OnEnter != nil {
+		buf.WriteString(", has entry action")
+	}
+	if si.OnExit != nil {
+		buf.WriteString(", has exit action")
+	}
+	if si.Compensation != nil {
+		buf.WriteString(", has compensation")
+	}
 	buf.WriteString("\n")
 	buf.WriteString(indentStr)
 	buf.WriteString("transitions:\n")
@@ -166,5 +346,23 @@ func (si *StateInfo) dump(buf *bytes.Buffer, indent int) {
 			buf.WriteString("\n")
 		}
 	}
+	if len(si.Done) > 0 {
+		buf.WriteString(indentStr)
+		buf.WriteString("done transitions:\n")
+		for _, tr := range si.Done {
+			buf.WriteString(trIndentStr)
+			tr.Dump(buf)
+			buf.WriteString("\n")
+		}
+	}
+	if len(si.OnError) > 0 {
+		buf.WriteString(indentStr)
+		buf.WriteString("error transitions:\n")
+		for _, tr := range si.OnError {
+			buf.WriteString(trIndentStr)
+			tr.Dump(buf)
+			buf.WriteString("\n")
+		}
+	}
 
 }
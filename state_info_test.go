@@ -15,8 +15,8 @@ func TestAddSubState(t *testing.T) {
 		t.Log("Parent-child links should be set up properly")
 		t.FailNow()
 	}
-	if len(okParent.Transitions) != 1 || okParent.Transitions[0].Guard == nil {
-		t.Log("Adoption should create an unconditional parent->child transition")
+	if len(okParent.Transitions) != 0 || okParent.startTransition().ToState != "sub" {
+		t.Log("Adoption should not touch parent transitions, start sub state is a separate link")
 		t.FailNow()
 	}
 
@@ -36,10 +36,9 @@ func TestAddSubState(t *testing.T) {
 		t.FailNow()
 	}
 
-	badParent = NewState("name", NewTransitionAlways("name->sub", "sub", nil))
-	badChild = NewState("sub", nil)
-	if err := badParent.addSubState(badChild, true); err == nil || err.Kind() != ErrStateIsInvalid {
-		t.Log("Adoption should fail (parent already has transitions defined)")
+	okParent = NewState("name", NewTransitionAlways("name-other", "other", nil))
+	if err := okParent.addSubState(NewState("sub", nil), true); err != nil || len(okParent.Transitions) != 1 {
+		t.Log("Adoption should succeed (parent transitions are kept)")
 		t.FailNow()
 	}
 }
@@ -175,6 +174,12 @@ func TestStateValidate(t *testing.T) {
 		t.FailNow()
 	}
 
+	si = NewState("name", nil).Entry(NewAction(nil))
+	if err := si.Validate(); err == nil || err.Kind() != ErrStateIsInvalid {
+		t.Log("State should be invalid (entry action without a functor)")
+		t.FailNow()
+	}
+
 	outer := NewState("outer", nil)
 	interm := NewState("interm", nil)
 	inner := NewState("inner", nil)
@@ -0,0 +1,107 @@
+package simple_fsm
+
+import (
+	"strings"
+)
+
+const (
+	FsmHistorySuffix = "#history"
+)
+
+// HistoryKind
+// Enum-like type describing what composite state remembers about its sub states
+// when it's exited, so it can be re-entered via "<state>#history" pseudo-state
+type HistoryKind int
+
+const (
+	// HistoryNone
+	// Nothing is remembered, re-entering history pseudo-state is not allowed
+	HistoryNone HistoryKind = iota
+	// HistoryShallow
+	// Last active direct sub state is remembered
+	HistoryShallow
+	// HistoryDeep
+	// Whole last active nested sub state path (down to the leaf) is remembered
+	HistoryDeep
+)
+
+// historyTarget
+// Parses transition destination, checks if it is a history pseudo-state
+// Returns name of the composite state the pseudo-state belongs to
+func historyTarget(to string) (state string, history bool) {
+	if strings.HasSuffix(to, FsmHistorySuffix) {
+		return strings.TrimSuffix(to, FsmHistorySuffix), true
+	}
+	return to, false
+}
+
+// stateMemory
+// Remembered sub states of exited composite state, outermost first
+// Contexts are empty unless composite state has HistoryContext flag set
+type stateMemory []StateContext
+
+// remember
+// Records history of composite states, which sub states were just popped from the stack
+// exited holds popped states in pop order (innermost first)
+func (fsm *Fsm) remember(exited []StateContext) {
+	for idx, sc := range exited {
+		parent := sc.state.Parent
+		if parent == nil || parent.HistoryKind == HistoryNone {
+			continue
+		}
+
+		var memory stateMemory
+		for pos := idx; pos >= 0; pos-- {
+			elem := newStateContext(exited[pos].state)
+			if parent.HistoryContext {
+				for k, v := range exited[pos].context.members {
+					elem.context.Put(k, v)
+				}
+			}
+			memory = append(memory, elem)
+			if parent.HistoryKind == HistoryShallow {
+				break
+			}
+		}
+		fsm.memory[parent.Name] = memory
+	}
+}
+
+// landing
+// Returns the state stack head is going to be at once given target is entered,
+// remembered sub states are recalled and start sub states are descended into (see take)
+// Target that is on the stack is exited first, so its active sub states are what is recalled
+func (fsm *Fsm) landing(stack *ContextStack, target *StateInfo, recall bool) *StateInfo {
+	state := target
+	if recall && target.HistoryKind != HistoryNone {
+		memory := fsm.memory[target.Name]
+		for idx := range stack.stack {
+			if stack.stack[idx].state == target && idx+1 < len(stack.stack) {
+				memory = stateMemory(stack.stack[idx+1:])
+				if target.HistoryKind == HistoryShallow {
+					memory = memory[:1]
+				}
+			}
+		}
+		if len(memory) > 0 {
+			state = memory[len(memory)-1].state
+		}
+	}
+	for state.StartSubState != nil {
+		state = state.StartSubState
+	}
+	return state
+}
+
+// recall
+// Pushes remembered sub states of given composite state (which is the head of the stack)
+// Does nothing if the state was never exited before
+func (fsm *Fsm) recall(stack *ContextStack, state *StateInfo) *FsmError {
+	for _, elem := range fsm.memory[state.Name] {
+		context := elem.context
+		if err := fsm.pushState(stack, elem.state, &context); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package simple_fsm
+
+import (
+	"testing"
+)
+
+func TestHistoryTarget(t *testing.T) {
+	if name, history := historyTarget("parent#history"); name != "parent" || !history {
+		t.Log("History pseudo-state should be recognized")
+		t.FailNow()
+	}
+	if name, history := historyTarget("parent"); name != "parent" || history {
+		t.Log("Regular state should not be treated as history pseudo-state")
+		t.FailNow()
+	}
+}
+
+// makeHistoryStructure
+// "wizard" has "step1" -> "nested" ("inner1" -> "inner2") sub states,
+// "pause" event leaves it for "paused" state, "resume" one returns via history
+func makeHistoryStructure(kind HistoryKind, context bool) *Structure {
+	fstr := NewStructure()
+	wizard := NewState("wizard", nil).Remember(kind, context)
+	fstr.AddStartState(wizard, nil)
+
+	pause := func(from string) Transition {
+		return NewEventTransition(from+"-paused", "pause", "paused", nil, nil)
+	}
+	fstr.AddStartState(NewState("step1", []Transition{
+		NewEventTransition("step1-nested", "next", "nested", nil, nil),
+		pause("step1"),
+	}), wizard)
+	nested := NewState("nested", nil)
+	fstr.AddState(nested, wizard)
+	fstr.AddStartState(NewState("inner1", []Transition{
+		NewEventTransition("inner1-inner2", "next", "inner2", nil, NewAction(func(ctx ContextOperator) error {
+			ctx.Put("visited", true)
+			return nil
+		})),
+		pause("inner1"),
+	}), nested)
+	fstr.AddState(NewState("inner2", []Transition{pause("inner2")}), nested)
+
+	fstr.AddState(NewState("paused", []Transition{
+		NewEventTransition("paused-wizard", "resume", "wizard#history", nil, nil),
+	}), nil)
+	return fstr
+}
+
+// leaveAndReturn
+// Walks down to "inner2", leaves "wizard" and returns to it via history
+func leaveAndReturn(t *testing.T, fsm *Fsm) {
+	for _, event := range []string{"next", "next", "pause", "resume"} {
+		if _, err := fsm.Fire(event, nil); err != nil {
+			t.Logf("Event \"%s\" failed: %s", event, err)
+			t.Log(Dump(fsm))
+			t.FailNow()
+		}
+	}
+}
+
+func TestFsmHistoryDeep(t *testing.T) {
+	fsm := NewFsm(makeHistoryStructure(HistoryDeep, true))
+	fsm.Run()
+	leaveAndReturn(t, fsm)
+
+	if fsm.stack.Peek().state.Name != "inner2" || fsm.stack.Depth() != 4 {
+		t.Log("Deep history should bring back the whole sub state path")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+	if visited, err := fsm.stack.Bool("visited"); !visited || err != nil {
+		t.Log("Remembered contexts should be restored")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+}
+
+func TestFsmHistoryShallow(t *testing.T) {
+	fsm := NewFsm(makeHistoryStructure(HistoryShallow, false))
+	fsm.Run()
+	leaveAndReturn(t, fsm)
+
+	if fsm.stack.Peek().state.Name != "inner1" || fsm.stack.Has("visited") {
+		t.Log("Shallow history should bring back only direct sub state, the rest is entered from the start")
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+}
+
+func TestFsmHistoryNotVisited(t *testing.T) {
+	fstr := makeHistoryStructure(HistoryDeep, false)
+	fstr.states["paused"].Transitions[0].Event = ""
+	fstr.start.StartSubState = fstr.states["paused"]
+
+	fsm := NewFsm(fstr)
+	fsm.Advance()
+	if step, err := fsm.Advance(); err != nil || step.to != "step1" {
+		t.Logf("History of never visited state should lead to its start sub state, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+}
+
+func TestStructureValidateHistory(t *testing.T) {
+	fstr := makeHistoryStructure(HistoryNone, false)
+	if err := fstr.Validate(); err == nil || err.Kind() != ErrFsmIsInvalid {
+		t.Logf("Validation should fail (targeted state has no history): %v", err)
+		t.FailNow()
+	}
+
+	fstr = makeHistoryStructure(HistoryDeep, false)
+	fstr.states["inner2"].Remember(HistoryShallow, false)
+	if err := fstr.Validate(); err == nil || err.Kind() != ErrStateIsInvalid {
+		t.Logf("Validation should fail (simple state can't have history): %v", err)
+		t.FailNow()
+	}
+}
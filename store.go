@@ -0,0 +1,169 @@
+package simple_fsm
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// Store
+// Persistent storage of FSM instances (snapshots) identified by instance ID
+// Every saved snapshot gets new version, which is checked on further modifications
+// (optimistic locking). Version 0 means the instance is not stored yet
+// * Save - stores the snapshot if stored version is equal to expected, returns new version
+// * Load - returns stored snapshot and its version
+// * Delete - removes the instance if stored version is equal to expected
+// * List - returns IDs of stored instances in lexical order
+type Store interface {
+	Save(id string, snapshot *Snapshot, expected int) (version int, err *FsmError)
+	Load(id string) (snapshot *Snapshot, version int, err *FsmError)
+	Delete(id string, expected int) *FsmError
+	List() ([]string, *FsmError)
+}
+
+// storeBinding
+// Store FSM persists itself to, along with its instance ID and last saved version
+type storeBinding struct {
+	store   Store
+	id      string
+	version int
+}
+
+// WithStore
+// Makes FSM save its snapshot to the store after every successful step and once it goes fatal
+// FSM is saved as a new instance unless it was loaded from the store (see LoadFsm)
+// Failed save is reported as step error, FSM status is not affected
+func WithStore(store Store, id string) FsmOption {
+	return func(fsm *Fsm) {
+		fsm.persistence = &storeBinding{store: store, id: id}
+	}
+}
+
+// LoadFsm
+// Restores FSM instance from the store (see RestoreFsm)
+// Loaded FSM keeps saving itself to the same instance
+func LoadFsm(store Store, id string, structure *Structure, options ...FsmOption) (fsm *Fsm, err *FsmError) {
+	snapshot, version, err := store.Load(id)
+	if err != nil {
+		return
+	}
+	if fsm, err = RestoreFsm(structure, snapshot, append(options, WithStore(store, id))...); err != nil {
+		return
+	}
+	fsm.persistence.version = version
+	return
+}
+
+// persist
+// Saves FSM snapshot to the store it's bound to (if any), truncates the journal
+func (fsm *Fsm) persist() *FsmError {
+	if fsm.persistence == nil {
+		return nil
+	}
+	snapshot, err := fsm.Snapshot()
+	if err != nil {
+		return err
+	}
+	version, err := fsm.persistence.store.Save(fsm.persistence.id, snapshot, fsm.persistence.version)
+	if err != nil {
+		return err
+	}
+	fsm.persistence.version = version
+
+	// saved snapshot covers all journaled actions
+	if fsm.journal != nil {
+		return fsm.journal.journal.Truncate(fsm.journal.id)
+	}
+	return nil
+}
+
+// MemoryStore
+// Store keeping instances in memory, goroutine-safe
+// Snapshots are kept serialized, so stored ones are not affected by callers
+type MemoryStore struct {
+	mu        sync.Mutex
+	instances map[string]storedInstance
+}
+
+// storedInstance
+// Serialized snapshot along with its version
+type storedInstance struct {
+	Version  int             `json:"version"`
+	Snapshot json.RawMessage `json:"snapshot"`
+}
+
+// NewMemoryStore
+// Constructs empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{instances: make(map[string]storedInstance)}
+}
+
+// Store.Save
+func (ms *MemoryStore) Save(id string, snapshot *Snapshot, expected int) (version int, err *FsmError) {
+	raw, e := json.Marshal(snapshot)
+	if e != nil {
+		return 0, newStoreErrorFailed(id, e)
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if current := ms.instances[id].Version; current != expected {
+		return 0, newStoreErrorVersionMismatch(id, expected, current)
+	}
+	version = expected + 1
+	ms.instances[id] = storedInstance{Version: version, Snapshot: raw}
+	return
+}
+
+// Store.Load
+func (ms *MemoryStore) Load(id string) (snapshot *Snapshot, version int, err *FsmError) {
+	ms.mu.Lock()
+	instance, present := ms.instances[id]
+	ms.mu.Unlock()
+
+	if !present {
+		err = newStoreErrorNotFound(id)
+		return
+	}
+	return instance.decode(id)
+}
+
+// Store.Delete
+func (ms *MemoryStore) Delete(id string, expected int) *FsmError {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	instance, present := ms.instances[id]
+	switch {
+	case !present:
+		return newStoreErrorNotFound(id)
+	case instance.Version != expected:
+		return newStoreErrorVersionMismatch(id, expected, instance.Version)
+	}
+	delete(ms.instances, id)
+	return nil
+}
+
+// Store.List
+func (ms *MemoryStore) List() ([]string, *FsmError) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ids := make([]string, 0, len(ms.instances))
+	for id := range ms.instances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// decode
+// Deserializes stored snapshot
+func (si *storedInstance) decode(id string) (snapshot *Snapshot, version int, err *FsmError) {
+	var decoded Snapshot
+	if e := json.Unmarshal(si.Snapshot, &decoded); e != nil {
+		err = newStoreErrorFailed(id, e)
+		return
+	}
+	return &decoded, si.Version, nil
+}
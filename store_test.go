@@ -0,0 +1,118 @@
+package simple_fsm
+
+import (
+	"testing"
+)
+
+// testStoreContract
+// Checks store behavior every implementation should have
+func testStoreContract(t *testing.T, store Store) {
+	snapshot := mustSnapshot(t, NewFsm(makeApprovalStructure()))
+
+	if _, _, err := store.Load("a"); err == nil || err.Kind() != ErrStoreNotFound {
+		t.Logf("Missing instance should not be loaded: %v", err)
+		t.FailNow()
+	}
+	if version, err := store.Save("a", snapshot, 0); err != nil || version != 1 {
+		t.Logf("New instance should be saved with version 1: %d, %v", version, err)
+		t.FailNow()
+	}
+	if _, err := store.Save("a", snapshot, 0); err == nil || err.Kind() != ErrStoreVersionMismatch {
+		t.Logf("Stale version should not be saved: %v", err)
+		t.FailNow()
+	}
+	if version, err := store.Save("a", snapshot, 1); err != nil || version != 2 {
+		t.Logf("Instance should be saved with next version: %d, %v", version, err)
+		t.FailNow()
+	}
+	store.Save("b", snapshot, 0)
+
+	loaded, version, err := store.Load("a")
+	if err != nil || version != 2 || loaded.Structure != snapshot.Structure || len(loaded.Stack) != len(snapshot.Stack) {
+		t.Logf("Instance should be loaded as saved: %d, %v", version, err)
+		t.FailNow()
+	}
+	if ids, err := store.List(); err != nil || len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Logf("Stored instances should be listed: %v, %v", ids, err)
+		t.FailNow()
+	}
+
+	if err := store.Delete("a", 1); err == nil || err.Kind() != ErrStoreVersionMismatch {
+		t.Logf("Stale version should not be deleted: %v", err)
+		t.FailNow()
+	}
+	if err := store.Delete("a", 2); err != nil {
+		t.Logf("Instance should be deleted: %v", err)
+		t.FailNow()
+	}
+	if err := store.Delete("a", 2); err == nil || err.Kind() != ErrStoreNotFound {
+		t.Logf("Deleted instance should not be found: %v", err)
+		t.FailNow()
+	}
+	if ids, _ := store.List(); len(ids) != 1 || ids[0] != "b" {
+		t.Logf("Deleted instance should not be listed: %v", ids)
+		t.FailNow()
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStoreContract(t, NewMemoryStore())
+}
+
+func TestFsmWithStore(t *testing.T) {
+	store := NewMemoryStore()
+	fsm := NewFsm(makeApprovalStructure(), WithStore(store, "req-1"))
+	if _, err := fsm.Run(); err == nil || err.Kind() != ErrFsmAwaitingEvent {
+		t.Logf("FSM should wait for approval: %v", err)
+		t.FailNow()
+	}
+	if _, version, err := store.Load("req-1"); err != nil || version != 1 {
+		t.Logf("FSM should be saved after a step: %d, %v", version, err)
+		t.FailNow()
+	}
+
+	// process restart: the instance is picked up from the store
+	loaded, err := LoadFsm(store, "req-1", makeApprovalStructure())
+	if err != nil || !loaded.Running() {
+		t.Logf("Stored FSM should be loaded: %v", err)
+		t.FailNow()
+	}
+	if _, err = loaded.Fire("approve", nil); err != nil {
+		t.Logf("Loaded FSM should continue: %v", err)
+		t.FailNow()
+	}
+	if res, _ := loaded.Result(); res != "approved" {
+		t.Logf("Loaded FSM should complete: %v", res)
+		t.FailNow()
+	}
+	if snapshot, version, _ := store.Load("req-1"); version != 2 || snapshot.History[len(snapshot.History)-1].To != "approved" {
+		t.Logf("Loaded FSM should save itself to the same instance: %d", version)
+		t.FailNow()
+	}
+
+	// stale copy can't overwrite newer progress
+	_, err = fsm.Fire("approve", nil)
+	if err == nil || err.Kind() != ErrStoreVersionMismatch || fsm.Fatal() {
+		t.Logf("Stale FSM should not be saved, error: %v", err)
+		t.FailNow()
+	}
+}
+
+func TestFsmWithStoreFatal(t *testing.T) {
+	store := NewMemoryStore()
+	fsm := NewFsm(makeListenerStructure(true), WithStore(store, "req-1"))
+	if fsm.Run(); !fsm.Fatal() {
+		t.Log("FSM should go fatal")
+		t.FailNow()
+	}
+
+	loaded, err := LoadFsm(store, "req-1", makeListenerStructure(false))
+	if err != nil || !loaded.Fatal() {
+		t.Logf("FSM should be saved as fatal: %v", err)
+		t.FailNow()
+	}
+	if _, err = loaded.Advance(); err == nil || err.Kind() != ErrFsmInFatalState {
+		t.Logf("Loaded FSM should not repeat the failed step: %v", err)
+		t.FailNow()
+	}
+}
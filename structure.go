@@ -2,14 +2,18 @@ package simple_fsm
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"sort"
 )
 
 // Structure
 // Holds static finite state machive information like states and transitions
 type Structure struct {
-	states map[string]*StateInfo
-	start  *StateInfo
+	states  map[string]*StateInfo
+	start   *StateInfo
+	metrics MetricsCollector
 }
 
 // NewStructure
@@ -64,6 +68,25 @@ func (fstr *Structure) AddStates(parent *StateInfo, start *StateInfo, states ...
 	return
 }
 
+// AddRegion
+// Validates and adds an orthogonal region to the parallel state
+// Region's own states are added as usual, with region as a parent
+func (fstr *Structure) AddRegion(region *StateInfo, parent *StateInfo) (err *FsmError) {
+	switch {
+	case region == nil:
+		return newFsmErrorStateIsInvalid(region, "region is nil")
+	case parent == nil:
+		return newFsmErrorInvalid("Region should have a parent")
+	}
+	if _, present := fstr.states[parent.Name]; !present {
+		return newFsmErrorInvalid("Parent state was not found (forgot to add?)")
+	}
+	if err = fstr.addStateImpl(region, nil, false, false); err != nil {
+		return
+	}
+	return parent.addRegion(region)
+}
+
 // addStateImpl
 // Adds a state to the state machine, validating it beforehand
 func (fstr *Structure) addStateImpl(state *StateInfo, parent *StateInfo, start bool, autoAdopt bool) (err *FsmError) {
@@ -72,11 +95,8 @@ func (fstr *Structure) addStateImpl(state *StateInfo, parent *StateInfo, start b
 		return newFsmErrorStateIsInvalid(state, "state is nil")
 	case fstr.start == nil:
 		return newFsmErrorInvalid("global state is not defined")
-	case start && parent == nil && !fstr.start.Final():
-		cause := fmt.Sprintf("start state is already set to \"%s\"", fstr.start.Transitions[0].Name)
-		return newFsmErrorInvalid(cause)
-	case start && autoAdopt && parent != nil && len(parent.Transitions) > 0:
-		cause := "parent should not have transitions (transition to start sub state is added automatically)"
+	case start && parent == nil && fstr.start.StartSubState != nil:
+		cause := fmt.Sprintf("start state is already set to \"%s\"", fstr.start.StartSubState.Name)
 		return newFsmErrorInvalid(cause)
 	}
 
@@ -133,6 +153,10 @@ func (fstr *Structure) appendStates(start *StateInfo, additional map[string]*Sta
 // Validate
 // Checks if FSM structure is consistent:
 // * no transitions to unknown
+// * no transitions across region boundaries
+// * internal transitions don't leave their states
+// * pseudo-states are not entered directly (they can't be start sub states, regions or parents)
+// * history pseudo-states are defined for targeted states
 // * no dead states
 func (fstr *Structure) Validate() (err *FsmError) {
 	stateRefs := make(map[string]bool)
@@ -147,8 +171,35 @@ func (fstr *Structure) Validate() (err *FsmError) {
 		if err := s.Validate(); err != nil {
 			return err
 		}
-		for _, tr := range s.Transitions {
-			if _, present := fstr.states[tr.ToState]; !present {
+		if !s.Parallel() && s.StartSubState == nil && len(s.Done) > 0 {
+			return newFsmErrorStateIsInvalid(s, "done transitions are only allowed for composite states")
+		}
+		for _, region := range s.Regions {
+			if region.Pseudo != PseudoNone {
+				return newFsmErrorStateIsInvalid(s, "pseudo-state can't be a region")
+			}
+			stateRefs[region.Name] = true
+		}
+		if s.Parent != nil && s.Parent.Pseudo != PseudoNone {
+			return newFsmErrorStateIsInvalid(s, "pseudo-state can't be a parent")
+		}
+		if s.StartSubState != nil {
+			if s.StartSubState.Pseudo != PseudoNone {
+				return newFsmErrorStateIsInvalid(s, "pseudo-state can't be a start sub state")
+			}
+			stateRefs[s.StartSubState.Name] = true
+		}
+		if s.HistoryKind != HistoryNone && s.StartSubState == nil {
+			return newFsmErrorStateIsInvalid(s, "only composite states with start sub state can have history")
+		}
+	}
+
+	// transitions are checked once all states are known to be consistent
+	for _, s := range fstr.states {
+		for _, tr := range s.allTransitions() {
+			name, history := historyTarget(tr.ToState)
+			target, present := fstr.states[name]
+			if !present {
 				cause := fmt.Sprintf(
 					"transition \"%s\" of state \"%s\" has unknown destination \"%s\"",
 					tr.Name,
@@ -157,11 +208,25 @@ func (fstr *Structure) Validate() (err *FsmError) {
 				)
 				return newFsmErrorInvalid(cause)
 			}
-			if ancestor, _ := findCommonAncestor(s, fstr.states[tr.ToState]); ancestor == nil {
-				cause := fmt.Sprintf("\"%s\" and \"%s\" don't have a common parent", s.Name, tr.ToState)
+			if tr.Kind == TransitionInternal && tr.ToState != s.Name {
+				cause := fmt.Sprintf("internal transition \"%s\" of state \"%s\" should point to the state itself",
+					tr.Name, s.Name)
+				return newFsmErrorInvalid(cause)
+			}
+			if history && target.HistoryKind == HistoryNone {
+				cause := fmt.Sprintf("transition \"%s\" of state \"%s\" targets history of \"%s\", which has none",
+					tr.Name, s.Name, name)
+				return newFsmErrorInvalid(cause)
+			}
+			if ancestor, _ := findCommonAncestor(s, target); ancestor == nil {
+				cause := fmt.Sprintf("\"%s\" and \"%s\" don't have a common parent", s.Name, name)
 				return newFsmErrorInvalid(cause)
 			}
-			stateRefs[tr.ToState] = true
+			if s.region() != target.region() {
+				cause := fmt.Sprintf("transition \"%s\" of state \"%s\" crosses region boundary", tr.Name, s.Name)
+				return newFsmErrorInvalid(cause)
+			}
+			stateRefs[name] = true
 		}
 	}
 
@@ -185,6 +250,42 @@ func (fstr *Structure) Validate() (err *FsmError) {
 	return nil
 }
 
+// Fingerprint
+// Returns a digest of state hierarchy and transitions identifying the structure
+// Actions and guards are not taken into account (see Snapshot)
+// States are hashed in name order, regions - in order they were added, since snapshots refer to them by position
+// (Builder adds regions in name order, so loading the same json always gives the same fingerprint)
+func (fstr *Structure) Fingerprint() string {
+	names := make([]string, 0, len(fstr.states))
+	for name := range fstr.states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		s := fstr.states[name]
+		fmt.Fprintf(h, "state %q", s.Name)
+		if s.Parent != nil {
+			fmt.Fprintf(h, " parent %q", s.Parent.Name)
+		}
+		if s.StartSubState != nil {
+			fmt.Fprintf(h, " startsub %q", s.StartSubState.Name)
+		}
+		for _, region := range s.Regions {
+			fmt.Fprintf(h, " region %q", region.Name)
+		}
+		fmt.Fprintf(h, " pseudo %d history %d %v\n", s.Pseudo, s.HistoryKind, s.HistoryContext)
+		for kind, trs := range [][]Transition{s.Transitions, s.Done, s.OnError} {
+			for _, tr := range trs {
+				fmt.Fprintf(h, "\t%d transition %q to %q on %q priority %d kind %d else %v\n",
+					kind, tr.Name, tr.ToState, tr.Event, tr.Priority, tr.Kind, tr.Else)
+			}
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
 func (fstr *Structure) dump(buf *bytes.Buffer, indent int) {
 	if len(fstr.states) == 0 {
 		buf.WriteString("\tno states\n")
@@ -87,10 +87,8 @@ func TestStructureAddStateNegative(t *testing.T) {
 		t.FailNow()
 	}
 
-	sub1 := NewState("sub1", NewTransitionAlways("sub1-last", "last", nil))
-	fstr.AddState(sub1, nil)
-	if err := fstr.AddStartState(NewState("sub2", nil), sub1); err == nil || err.Kind() != ErrFsmIsInvalid {
-		t.Logf("Should detect an error (parent->sub should have 1 transition): %#v", err)
+	if err := fstr.AddStartState(NewState("other", nil), nil); err == nil || err.Kind() != ErrFsmIsInvalid {
+		t.Logf("Should detect an error (start state is already set): %#v", err)
 		t.FailNow()
 	}
 }
@@ -206,3 +204,56 @@ func TestStructureValidate(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestStructureAddRegion(t *testing.T) {
+	fstr := NewStructure()
+	parallel := NewState("parallel", nil)
+	fstr.AddStartState(parallel, nil)
+
+	if err := fstr.AddRegion(NewState("region", nil), NewState("unknown", nil)); err == nil || err.Kind() != ErrFsmIsInvalid {
+		t.Logf("Should detect an error (parent not added): %#v", err)
+		t.FailNow()
+	}
+
+	region, other := NewState("region", nil), NewState("other", nil)
+	if err := fstr.AddRegion(region, parallel); err != nil {
+		t.Logf("Adding a region failed: %s", err)
+		t.FailNow()
+	}
+	fstr.AddRegion(other, parallel)
+	fstr.AddStartState(NewState("r1", NewTransitionAlways("r1-o2", "o2", nil)), region)
+	if err := fstr.Validate(); err == nil || err.Kind() != ErrStateIsInvalid {
+		t.Logf("Validation should fail (region without start sub state): %v", err)
+		t.FailNow()
+	}
+
+	fstr.AddStartState(NewState("o1", NewTransitionAlways("o1-o2", "o2", nil)), other)
+	fstr.AddState(NewState("o2", nil), other)
+	if err := fstr.Validate(); err == nil || err.Kind() != ErrFsmIsInvalid {
+		t.Logf("Validation should fail (transition between regions): %v", err)
+		t.FailNow()
+	}
+
+	region.StartSubState.Transitions = nil
+	if err := fstr.Validate(); err != nil {
+		t.Logf("Unexpected validation error: %s", err)
+		t.Log(Dump(fstr))
+		t.FailNow()
+	}
+
+	if err := fstr.AddStartState(NewState("sub", nil), parallel); err == nil {
+		t.Log("Should detect an error (parallel state can't have start sub state)")
+		t.FailNow()
+	}
+}
+
+func TestStructureValidateInternal(t *testing.T) {
+	fstr := MakeStructure(nil,
+		NewState("1", []Transition{NewTransition("1-2", "2", guardAlways, nil).Internal()}),
+		NewState("2", nil),
+	)
+	if err := fstr.Validate(); err == nil || err.Kind() != ErrFsmIsInvalid {
+		t.Logf("Validation should fail (internal transition leads to another state): %v", err)
+		t.FailNow()
+	}
+}
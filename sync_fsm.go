@@ -0,0 +1,235 @@
+package simple_fsm
+
+import (
+	"bytes"
+	"context"
+	"sync"
+)
+
+// SyncFsm
+// Goroutine-safe wrapper around Fsm with the same API
+// All operations are serialized with a mutex, Run/RunContext
+// release it between steps, so FSM status can be observed while it runs
+type SyncFsm struct {
+	mu  sync.Mutex
+	fsm *Fsm
+}
+
+// NewSyncFsm
+// Constructs new goroutine-safe state machine (see NewFsm)
+func NewSyncFsm(structure *Structure, options ...FsmOption) *SyncFsm {
+	return &SyncFsm{fsm: NewFsm(structure, options...)}
+}
+
+// RestoreSyncFsm
+// Constructs goroutine-safe state machine from a snapshot (see RestoreFsm)
+func RestoreSyncFsm(structure *Structure, snapshot *Snapshot, options ...FsmOption) (*SyncFsm, *FsmError) {
+	fsm, err := RestoreFsm(structure, snapshot, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncFsm{fsm: fsm}, nil
+}
+
+// LoadSyncFsm
+// Constructs goroutine-safe state machine from a stored instance (see LoadFsm)
+func LoadSyncFsm(store Store, id string, structure *Structure, options ...FsmOption) (*SyncFsm, *FsmError) {
+	fsm, err := LoadFsm(store, id, structure, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncFsm{fsm: fsm}, nil
+}
+
+// RecoverSyncFsm
+// Constructs goroutine-safe state machine from a stored instance and its journal (see RecoverFsm)
+func RecoverSyncFsm(store Store, journal Journal, id string, structure *Structure, options ...FsmOption) (*SyncFsm, *FsmError) {
+	fsm, err := RecoverFsm(store, journal, id, structure, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncFsm{fsm: fsm}, nil
+}
+
+// Reset
+// See Fsm.Reset
+func (sf *SyncFsm) Reset() {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.fsm.Reset()
+}
+
+// SetInput
+// See Fsm.SetInput
+func (sf *SyncFsm) SetInput(key string, value interface{}) *FsmError {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.fsm.SetInput(key, value)
+}
+
+// Fatal
+// See Fsm.Fatal
+func (sf *SyncFsm) Fatal() bool {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.fsm.Fatal()
+}
+
+// Running
+// See Fsm.Running
+func (sf *SyncFsm) Running() bool {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.fsm.Running()
+}
+
+// Completed
+// See Fsm.Completed
+func (sf *SyncFsm) Completed() bool {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.fsm.Completed()
+}
+
+// Idle
+// See Fsm.Idle
+func (sf *SyncFsm) Idle() bool {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.fsm.Idle()
+}
+
+// Result
+// See Fsm.Result
+func (sf *SyncFsm) Result() (value interface{}, err *FsmError) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.fsm.Result()
+}
+
+// History
+// Returns a copy of FSM history, so it can be read while FSM runs
+func (sf *SyncFsm) History() History {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return append(History(nil), sf.fsm.History()...)
+}
+
+// Snapshot
+// See Fsm.Snapshot
+func (sf *SyncFsm) Snapshot() (*Snapshot, *FsmError) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.fsm.Snapshot()
+}
+
+// InDoubt
+// Returns a copy of in-doubt action intents
+func (sf *SyncFsm) InDoubt() []JournalRecord {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return append([]JournalRecord(nil), sf.fsm.InDoubt()...)
+}
+
+// Resolve
+// See Fsm.Resolve
+func (sf *SyncFsm) Resolve(seq int, executed bool, writes map[string]interface{}) *FsmError {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.fsm.Resolve(seq, executed, writes)
+}
+
+// AddListener
+// See Fsm.AddListener
+// Listeners are called while the lock is held, so they should not call SyncFsm methods
+func (sf *SyncFsm) AddListener(listener Listener) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.fsm.AddListener(listener)
+}
+
+// Compensate
+// See Fsm.Compensate
+func (sf *SyncFsm) Compensate() *FsmError {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.fsm.Compensate()
+}
+
+// Compensations
+// Returns a copy of compensation outcomes
+func (sf *SyncFsm) Compensations() []CompensationOutcome {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return append([]CompensationOutcome(nil), sf.fsm.Compensations()...)
+}
+
+// Advance
+// See Fsm.Advance
+func (sf *SyncFsm) Advance() (step HistoryItem, err *FsmError) {
+	return sf.AdvanceContext(context.Background())
+}
+
+// AdvanceContext
+// See Fsm.AdvanceContext
+func (sf *SyncFsm) AdvanceContext(ctx context.Context) (step HistoryItem, err *FsmError) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.fsm.AdvanceContext(ctx)
+}
+
+// Fire
+// See Fsm.Fire
+func (sf *SyncFsm) Fire(event string, payload map[string]interface{}) (step HistoryItem, err *FsmError) {
+	return sf.FireContext(context.Background(), event, payload)
+}
+
+// FireContext
+// See Fsm.FireContext
+func (sf *SyncFsm) FireContext(ctx context.Context, event string, payload map[string]interface{}) (step HistoryItem, err *FsmError) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	return sf.fsm.FireContext(ctx, event, payload)
+}
+
+// Run
+// See Fsm.Run
+func (sf *SyncFsm) Run() (res interface{}, err *FsmError) {
+	return sf.RunContext(context.Background())
+}
+
+// RunContext
+// See Fsm.RunContext, lock is held for one step at a time
+func (sf *SyncFsm) RunContext(ctx context.Context) (res interface{}, err *FsmError) {
+	for done := false; !done; {
+		done, res, err = sf.runStep(ctx)
+	}
+	return
+}
+
+// runStep
+// Makes a single Run step under the lock
+// Returns done == true when Run should stop, res and err are final then
+func (sf *SyncFsm) runStep(ctx context.Context) (done bool, res interface{}, err *FsmError) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+
+	if !sf.fsm.Completed() && !sf.fsm.Fatal() {
+		if _, err = sf.fsm.AdvanceContext(ctx); err == nil {
+			return
+		}
+	}
+	done = true
+	if sf.fsm.Completed() {
+		res, err = sf.fsm.Result()
+	}
+	return
+}
+
+// dump
+// Print out an object in a user-friendly way, composable
+func (sf *SyncFsm) dump(buf *bytes.Buffer, indent int) {
+	sf.mu.Lock()
+	defer sf.mu.Unlock()
+	sf.fsm.dump(buf, indent)
+}
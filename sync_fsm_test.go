@@ -0,0 +1,117 @@
+package simple_fsm
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSyncFsmConcurrentAdvance(t *testing.T) {
+	const steps = 50
+	count := NewAction(func(ctx ContextOperator) error {
+		counter, err := ctx.Int("counter")
+		if err != nil {
+			return err
+		}
+		ctx.PutParent("counter", counter+1)
+		return nil
+	})
+	done := func(ctx ContextAccessor) (bool, error) {
+		counter, err := ctx.Int("counter")
+		if err != nil {
+			return false, err
+		}
+		return counter >= steps, nil
+	}
+	notDone := func(ctx ContextAccessor) (bool, error) {
+		open, err := done(ctx)
+		return !open, err
+	}
+
+	fstr := NewStructure()
+	loop := NewState("loop", nil)
+	fstr.AddStartState(loop, nil)
+	loop.Transitions = []Transition{
+		NewTransition("loop-again", "again", notDone, count),
+		NewTransition("loop-last", "last", done, NewAction(func(ctx ContextOperator) error {
+			ctx.PutResult(true)
+			return nil
+		})),
+	}
+	fstr.AddStates(nil, nil,
+		NewState("again", NewTransitionAlways("again-loop", "loop", nil)),
+		NewState("last", nil),
+	)
+
+	fsm := NewSyncFsm(fstr)
+	if err := fsm.SetInput("counter", 0); err != nil {
+		t.Logf("Setting input failed: %s", err)
+		t.FailNow()
+	}
+
+	var wg sync.WaitGroup
+	for idx := 0; idx < 8; idx++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for !fsm.Completed() && !fsm.Fatal() {
+				fsm.Advance()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for !fsm.Completed() && !fsm.Fatal() {
+				history := fsm.History()
+				history.Dump()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for !fsm.Completed() && !fsm.Fatal() {
+				fsm.Result()
+				Dump(fsm)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if res, err := fsm.Result(); err != nil || res != true {
+		t.Logf("FSM should complete, error: %v", err)
+		t.Log(Dump(fsm))
+		t.FailNow()
+	}
+	if history := fsm.History(); len(history) != 2*steps+2 {
+		t.Logf("Each step should be made exactly once, history:\n%s", history.Dump())
+		t.FailNow()
+	}
+}
+
+func TestSyncFsmConcurrentRun(t *testing.T) {
+	succ := NewAction(func(ctx ContextOperator) error { ctx.PutResult(true); return nil })
+	fsm := NewSyncFsm(MakeStructure(nil,
+		NewState("1", NewTransitionAlways("1-2", "2", nil)),
+		NewState("2", NewTransitionAlways("2-3", "3", succ)),
+		NewState("3", nil),
+	))
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 4)
+	for idx := range results {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			results[idx], _ = fsm.Run()
+		}(idx)
+	}
+	wg.Wait()
+
+	for _, res := range results {
+		if res != true {
+			t.Logf("All runners should see FSM result, got: %v", results)
+			t.FailNow()
+		}
+	}
+	if history := fsm.History(); len(history) != 3 {
+		t.Logf("Steps should not be repeated by concurrent runners, history:\n%s", history.Dump())
+		t.FailNow()
+	}
+}
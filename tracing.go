@@ -0,0 +1,317 @@
+package simple_fsm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Tracer
+// Starts spans of FSM run, shaped after OpenTelemetry tracer (see TracerFunc for an adapter)
+// Span parent is the one carried by ctx (if any), returned context carries the new span
+// * Run - "fsm.run" span (see RunContext)
+// * Advance, Fire - "fsm.step" span, child of the run one
+// * guard and action invocations - "fsm.guard" and "fsm.action" spans, children of the step one
+// Go context of callbacks (see GoContext) carries their span, so user spans are nested properly
+type Tracer interface {
+	Start(ctx context.Context, name string, attrs ...TraceAttr) (context.Context, Span)
+}
+
+// Span
+// Traced operation, ended exactly once
+// * SetAttributes - adds or overwrites span attributes
+// * RecordError - marks span as failed
+// * End - completes the span
+type Span interface {
+	SetAttributes(attrs ...TraceAttr)
+	RecordError(err error)
+	End()
+}
+
+// TraceAttr
+// Span attribute, value is one of string, int, bool, float64
+// (so it maps directly to OpenTelemetry attribute.KeyValue)
+type TraceAttr struct {
+	Key   string
+	Value interface{}
+}
+
+// traceValue
+// Converts arbitrary value to the one allowed for attributes
+func traceValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string, int, bool, float64:
+		return v
+	case int64:
+		return int(v)
+	case float32:
+		return float64(v)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// TracerFunc
+// Adapts a function to Tracer, e.g. the one wrapping OpenTelemetry tracer:
+//
+//	TracerFunc(func(ctx context.Context, name string, attrs ...TraceAttr) (context.Context, Span) {
+//		ctx, span := otelTracer.Start(ctx, name, trace.WithAttributes(convert(attrs)...))
+//		return ctx, SpanFuncs{
+//			SetAttributesFn: func(attrs ...TraceAttr) { span.SetAttributes(convert(attrs)...) },
+//			RecordErrorFn:   func(err error) { span.RecordError(err); span.SetStatus(codes.Error, err.Error()) },
+//			EndFn:           func() { span.End() },
+//		}
+//	})
+type TracerFunc func(ctx context.Context, name string, attrs ...TraceAttr) (context.Context, Span)
+
+// Tracer.Start
+func (fn TracerFunc) Start(ctx context.Context, name string, attrs ...TraceAttr) (context.Context, Span) {
+	return fn(ctx, name, attrs...)
+}
+
+// SpanFuncs
+// Adapts a set of functions to Span (see TracerFunc), missing ones are no-op
+type SpanFuncs struct {
+	SetAttributesFn func(attrs ...TraceAttr)
+	RecordErrorFn   func(err error)
+	EndFn           func()
+}
+
+// Span.SetAttributes
+func (sf SpanFuncs) SetAttributes(attrs ...TraceAttr) {
+	if sf.SetAttributesFn != nil {
+		sf.SetAttributesFn(attrs...)
+	}
+}
+
+// Span.RecordError
+func (sf SpanFuncs) RecordError(err error) {
+	if sf.RecordErrorFn != nil {
+		sf.RecordErrorFn(err)
+	}
+}
+
+// Span.End
+func (sf SpanFuncs) End() {
+	if sf.EndFn != nil {
+		sf.EndFn()
+	}
+}
+
+// WithTracer
+// Makes FSM report its run as a trace (see Tracer)
+func WithTracer(tracer Tracer) FsmOption {
+	return func(fsm *Fsm) {
+		fsm.tracer = tracer
+	}
+}
+
+// startSpan
+// Starts a span (if FSM has a tracer), nil span is no-op
+func (fsm *Fsm) startSpan(ctx context.Context, name string, attrs ...TraceAttr) (context.Context, Span) {
+	if fsm.tracer == nil {
+		return ctx, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if id := fsm.instanceID(); id != "" {
+		attrs = append([]TraceAttr{{"fsm.instance", id}}, attrs...)
+	}
+	return fsm.tracer.Start(ctx, name, attrs...)
+}
+
+// endSpan
+// Records an error (if any) and ends the span
+func endSpan(span Span, e error) {
+	if span == nil {
+		return
+	}
+	if e != nil {
+		attrs := []TraceAttr{{"fsm.error", e.Error()}}
+		if fsmErr, ok := e.(*FsmError); ok {
+			attrs = append(attrs, TraceAttr{"fsm.error.kind", fsmErr.Kind().String()})
+		}
+		span.SetAttributes(attrs...)
+		span.RecordError(e)
+	}
+	span.End()
+}
+
+// fsmError
+// Converts FSM error to error interface, keeping nil untyped
+func fsmError(err *FsmError) error {
+	if err == nil {
+		return nil
+	}
+	return err
+}
+
+// startStepSpan, endStepSpan
+// Start and end "fsm.step" span, the latter describes the step made (if any)
+func (fsm *Fsm) startStepSpan(ctx context.Context, event string) (context.Context, Span) {
+	attrs := []TraceAttr{{"fsm.step", len(fsm.history)}}
+	if event != "" {
+		attrs = append(attrs, TraceAttr{"fsm.event", event})
+	}
+	return fsm.startSpan(ctx, "fsm.step", attrs...)
+}
+
+func (fsm *Fsm) endStepSpan(span Span, step *HistoryItem, err *FsmError) {
+	if span != nil && step.transition != "" {
+		span.SetAttributes(
+			TraceAttr{"fsm.from", step.from},
+			TraceAttr{"fsm.to", step.to},
+			TraceAttr{"fsm.transition", step.transition},
+		)
+	}
+	endSpan(span, fsmError(err))
+}
+
+// traceCallback
+// Executes guard or action within its own span, child of the step one
+// Go context seen by the callback carries the span
+func (fsm *Fsm) traceCallback(name string, attrs []TraceAttr, callback func() error) error {
+	if fsm.tracer == nil {
+		return callback()
+	}
+	outer := fsm.stack.goCtx
+	ctx, span := fsm.startSpan(outer, name, attrs...)
+	fsm.stack.goCtx = ctx
+	e := callback()
+	fsm.stack.goCtx = outer
+	endSpan(span, e)
+	return e
+}
+
+// traceGuard
+// Evaluates transition guard within "fsm.guard" span
+func (fsm *Fsm) traceGuard(stack *ContextStack, state *StateInfo, tr *Transition) (open bool, err error) {
+	attrs := []TraceAttr{{"fsm.state", state.Name}, {"fsm.transition", tr.Name}}
+	err = fsm.traceCallback("fsm.guard", attrs, func() (e error) {
+		open, e = fsm.evalGuard(stack, state, tr)
+		return
+	})
+	return
+}
+
+// traceAction
+// Executes single action attempt within "fsm.action" span
+// Action parameters are added as "fsm.param." attributes
+func (fsm *Fsm) traceAction(ctx ContextOperator, who string, name string, attempt int, action *PackagedAction) error {
+	if fsm.tracer == nil {
+		return fsm.invoke(ctx, who, name, action)
+	}
+	attrs := []TraceAttr{{"fsm.callback", who}, {"fsm.name", name}, {"fsm.attempt", attempt}}
+	for k, v := range action.Params {
+		attrs = append(attrs, TraceAttr{"fsm.param." + k, traceValue(v)})
+	}
+	return fsm.traceCallback("fsm.action", attrs, func() error {
+		return fsm.invoke(ctx, who, name, action)
+	})
+}
+
+// SpanRecord
+// Span recorded by MemoryTracer, Parent is 0 for root spans (IDs start with 1)
+type SpanRecord struct {
+	ID     int
+	Parent int
+	Name   string
+	Attrs  map[string]interface{}
+	Err    error
+	Start  time.Time
+	End    time.Time
+	Ended  bool
+}
+
+// MemoryTracer
+// Tracer keeping spans in memory, meant for tests, goroutine-safe
+type MemoryTracer struct {
+	mu    sync.Mutex
+	clock Clock
+	spans []SpanRecord
+}
+
+// memorySpanKey
+// Context key of the span started by MemoryTracer
+type memorySpanKey struct{}
+
+// memorySpan
+// Span started by MemoryTracer, refers to its record by ID
+type memorySpan struct {
+	tracer *MemoryTracer
+	id     int
+}
+
+// NewMemoryTracer
+// Constructs empty in-memory tracer, span times are taken from the clock (system one if nil)
+func NewMemoryTracer(clock Clock) *MemoryTracer {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &MemoryTracer{clock: clock}
+}
+
+// Tracer.Start
+func (mt *MemoryTracer) Start(ctx context.Context, name string, attrs ...TraceAttr) (context.Context, Span) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	record := SpanRecord{ID: len(mt.spans) + 1, Name: name, Attrs: make(map[string]interface{}), Start: mt.clock.Now()}
+	if parent, ok := ctx.Value(memorySpanKey{}).(*memorySpan); ok && parent.tracer == mt {
+		record.Parent = parent.id
+	}
+	for _, attr := range attrs {
+		record.Attrs[attr.Key] = attr.Value
+	}
+	mt.spans = append(mt.spans, record)
+
+	span := &memorySpan{mt, record.ID}
+	return context.WithValue(ctx, memorySpanKey{}, span), span
+}
+
+// Spans
+// Returns copies of spans started so far, in order they were started
+func (mt *MemoryTracer) Spans() []SpanRecord {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	spans := make([]SpanRecord, len(mt.spans))
+	for idx, span := range mt.spans {
+		span.Attrs = make(map[string]interface{}, len(span.Attrs))
+		for k, v := range mt.spans[idx].Attrs {
+			span.Attrs[k] = v
+		}
+		spans[idx] = span
+	}
+	return spans
+}
+
+// update
+// Modifies span record under the lock
+func (ms *memorySpan) update(fn func(*SpanRecord)) {
+	ms.tracer.mu.Lock()
+	defer ms.tracer.mu.Unlock()
+	fn(&ms.tracer.spans[ms.id-1])
+}
+
+// Span.SetAttributes
+func (ms *memorySpan) SetAttributes(attrs ...TraceAttr) {
+	ms.update(func(record *SpanRecord) {
+		for _, attr := range attrs {
+			record.Attrs[attr.Key] = attr.Value
+		}
+	})
+}
+
+// Span.RecordError
+func (ms *memorySpan) RecordError(err error) {
+	ms.update(func(record *SpanRecord) { record.Err = err })
+}
+
+// Span.End
+func (ms *memorySpan) End() {
+	ms.update(func(record *SpanRecord) {
+		record.End, record.Ended = ms.tracer.clock.Now(), true
+	})
+}
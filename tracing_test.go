@@ -0,0 +1,132 @@
+package simple_fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// spanTree
+// Describes recorded spans as "name<-parent name" strings
+func spanTree(spans []SpanRecord) (tree []string) {
+	for _, span := range spans {
+		parent := ""
+		if span.Parent > 0 {
+			parent = spans[span.Parent-1].Name
+		}
+		tree = append(tree, span.Name+"<-"+parent)
+	}
+	return
+}
+
+func TestFsmTracer(t *testing.T) {
+	tracer := NewMemoryTracer(nil)
+	fsm := NewFsm(makeTracedStructure(tracer, false), WithTracer(tracer))
+	if _, err := fsm.Run(); err != nil {
+		t.Logf("Run failed: %s", err.Error())
+		t.FailNow()
+	}
+
+	spans := tracer.Spans()
+	expected := []string{
+		"fsm.run<-",
+		"fsm.step<-fsm.run",
+		"fsm.guard<-fsm.step",
+		"fsm.step<-fsm.run",
+		"fsm.guard<-fsm.step",
+		"fsm.action<-fsm.step",
+		"payment<-fsm.action",
+	}
+	if tree := spanTree(spans); !reflect.DeepEqual(tree, expected) {
+		t.Logf("Spans are different from expected:\n%v", tree)
+		t.FailNow()
+	}
+	for _, span := range spans {
+		if !span.Ended || span.Err != nil {
+			t.Logf("Span should be ended successfully: %+v", span)
+			t.FailNow()
+		}
+	}
+
+	step, guard, action := spans[3].Attrs, spans[4].Attrs, spans[5].Attrs
+	if step["fsm.step"] != 1 || step["fsm.from"] != "new" || step["fsm.to"] != "paid" || step["fsm.transition"] != "new-paid" {
+		t.Logf("Step span attributes are different from expected: %v", step)
+		t.FailNow()
+	}
+	if guard["fsm.state"] != "new" || guard["fsm.transition"] != "new-paid" {
+		t.Logf("Guard span attributes are different from expected: %v", guard)
+		t.FailNow()
+	}
+	if action["fsm.callback"] != "transition action" || action["fsm.name"] != "new-paid" ||
+		action["fsm.attempt"] != 1 || action["fsm.param.amount"] != 42 {
+		t.Logf("Action span attributes are different from expected: %v", action)
+		t.FailNow()
+	}
+}
+
+func TestFsmTracerFailure(t *testing.T) {
+	tracer := NewMemoryTracer(nil)
+	fsm := NewFsm(makeTracedStructure(tracer, true), WithTracer(tracer), WithStore(NewMemoryStore(), "order-1"))
+	fsm.Run()
+
+	spans := tracer.Spans()
+	action, step, run := spans[5], spans[3], spans[0]
+	if action.Err == nil || action.Err.Error() != "declined" || action.Attrs["fsm.error.kind"] != nil {
+		t.Logf("Action span should record its error: %+v", action)
+		t.FailNow()
+	}
+	if step.Err == nil || step.Attrs["fsm.error.kind"] != "ErrFsmCallbackFailed" || run.Err == nil {
+		t.Logf("Step and run spans should record FSM error: %+v, %+v", step, run)
+		t.FailNow()
+	}
+	for _, span := range spans[:6] {
+		if span.Attrs["fsm.instance"] != "order-1" {
+			t.Logf("Span should carry instance ID: %+v", span)
+			t.FailNow()
+		}
+	}
+}
+
+func TestFsmTracerAdvance(t *testing.T) {
+	tracer := NewMemoryTracer(nil)
+	fsm := NewFsm(makeTracedStructure(tracer, false), WithTracer(tracer))
+
+	ctx, parent := tracer.Start(context.Background(), "request")
+	fsm.AdvanceContext(ctx)
+	parent.End()
+
+	expected := []string{"request<-", "fsm.step<-request", "fsm.guard<-fsm.step"}
+	if tree := spanTree(tracer.Spans()); !reflect.DeepEqual(tree, expected) {
+		t.Logf("Step should be a child of the span carried by go context:\n%v", tree)
+		t.FailNow()
+	}
+}
+
+func TestTracerFunc(t *testing.T) {
+	var events []string
+	tracer := TracerFunc(func(ctx context.Context, name string, attrs ...TraceAttr) (context.Context, Span) {
+		events = append(events, "start "+name)
+		return ctx, SpanFuncs{
+			RecordErrorFn: func(err error) { events = append(events, "error "+err.Error()) },
+			EndFn:         func() { events = append(events, "end "+name) },
+		}
+	})
+
+	fsm := NewFsm(makeTracedStructure(tracer, true), WithTracer(tracer))
+	fsm.Advance()
+	fsm.Advance()
+
+	expected := []string{
+		"start fsm.step", "start fsm.guard", "end fsm.guard", "end fsm.step",
+		"start fsm.step", "start fsm.guard", "end fsm.guard",
+		"start fsm.action", "start payment", "end payment", "error declined", "end fsm.action",
+	}
+	if !reflect.DeepEqual(events[:len(expected)], expected) {
+		t.Logf("Adapted tracer events are different from expected:\n%v", events)
+		t.FailNow()
+	}
+	if events[len(events)-1] != "end fsm.step" {
+		t.Logf("Step span should be ended last: %v", events)
+		t.FailNow()
+	}
+}
@@ -16,15 +16,25 @@ type ActionFn func(ctx ContextOperator) error
 // PackagedAction
 // Encapsulates an action functor and it's input parameters
 // that are put to the context right before action execution
+// Optional retry policy makes FSM execute failed action again
 type PackagedAction struct {
 	Fn     ActionFn
 	Params map[string]interface{}
+	Retry  *RetryPolicy
 }
 
 // NewAction
 // Constructs new action based on a functor
 func NewAction(fn ActionFn) *PackagedAction {
-	return &PackagedAction{fn, nil}
+	return &PackagedAction{Fn: fn}
+}
+
+// WithRetry
+// Sets action retry policy
+// Returns action pointer, so calls can be chained
+func (pa *PackagedAction) WithRetry(policy RetryPolicy) *PackagedAction {
+	pa.Retry = &policy
+	return pa
 }
 
 // Param
@@ -59,30 +69,100 @@ func (pa *PackagedAction) Do(ctx ContextOperator) error {
 func (pa *PackagedAction) Validate() (err *FsmError) {
 	if pa.Fn == nil {
 		err = newFsmErrorInvalid("PackagedAction should specify a functor")
+	} else if pa.Retry != nil {
+		err = pa.Retry.Validate()
 	}
 	return
 }
 
+// TransitionKind
+// Enum-like type describing how transition affects active states
+type TransitionKind int
+
+const (
+	// TransitionExternal
+	// Source state is exited and destination one is entered
+	// (even if they are the same state, fresh context is created then)
+	TransitionExternal TransitionKind = iota
+	// TransitionInternal
+	// Active states are left as they are, only transition action is executed
+	// Internal transition should point to the state declaring it
+	TransitionInternal
+)
+
 // Transition
 // Describes transition to a state, guard included
+// Transitions with non-empty Event are only considered when
+// an event with the same name is fired (see Fsm.Fire)
+// Priority is used to choose between several opened transitions
+// (bigger goes first, see ConflictPolicy)
+// Else transition of a pseudo-state is taken when all other ones are closed
+// Compensation undoes the effect of the action (see Fsm.Compensate)
 type Transition struct {
-	Name    string
-	ToState string
-	Guard   GuardFn
-	Action  *PackagedAction
+	Name         string
+	ToState      string
+	Event        string
+	Priority     int
+	Kind         TransitionKind
+	Else         bool
+	Guard        GuardFn
+	Action       *PackagedAction
+	Compensation *PackagedAction
+}
+
+// guardAlways
+// Guard that is always open, used for unconditional transitions
+func guardAlways(ContextAccessor) (bool, error) {
+	return true, nil
 }
 
 // NewTransition
 // Creates new transition instance
 func NewTransition(name string, to string, cond GuardFn, action *PackagedAction) Transition {
-	return Transition{name, to, cond, action}
+	return Transition{Name: name, ToState: to, Guard: cond, Action: action}
 }
 
 // NewTransitionAlways
 // Creates transitions slice with single, unconditional transition
 func NewTransitionAlways(name string, to string, action *PackagedAction) []Transition {
-	always := func(ContextAccessor) (bool, error) { return true, nil }
-	return []Transition{Transition{name, to, always, action}}
+	return []Transition{NewTransition(name, to, guardAlways, action)}
+}
+
+// NewEventTransition
+// Creates new transition triggered by a named event
+// nil guard means that transition is taken every time the event is fired
+func NewEventTransition(name string, event string, to string, cond GuardFn, action *PackagedAction) Transition {
+	if cond == nil {
+		cond = guardAlways
+	}
+	return Transition{Name: name, ToState: to, Event: event, Guard: cond, Action: action}
+}
+
+// NewElseTransition
+// Creates pseudo-state transition which is taken when all other ones are closed
+func NewElseTransition(name string, to string, action *PackagedAction) Transition {
+	return Transition{Name: name, ToState: to, Else: true, Guard: guardAlways, Action: action}
+}
+
+// Prioritize
+// Returns a copy of the transition with given priority
+func (tr Transition) Prioritize(priority int) Transition {
+	tr.Priority = priority
+	return tr
+}
+
+// WithCompensation
+// Returns a copy of the transition with given compensating action
+func (tr Transition) WithCompensation(action *PackagedAction) Transition {
+	tr.Compensation = action
+	return tr
+}
+
+// Internal
+// Returns a copy of the transition that doesn't leave the state (see TransitionInternal)
+func (tr Transition) Internal() Transition {
+	tr.Kind = TransitionInternal
+	return tr
 }
 
 // Validate
@@ -100,6 +180,9 @@ func (tr *Transition) Validate() (err *FsmError) {
 	if err == nil && tr.Action != nil {
 		err = tr.Action.Validate()
 	}
+	if err == nil && tr.Compensation != nil {
+		err = tr.Compensation.Validate()
+	}
 
 	return
 }
@@ -112,6 +195,20 @@ func (tr *Transition) Dump(buf *bytes.Buffer) {
 	buf.WriteString("\", to: \"")
 	buf.WriteString(tr.ToState)
 	buf.WriteString("\", ")
+	if tr.Event != "" {
+		buf.WriteString("on: \"")
+		buf.WriteString(tr.Event)
+		buf.WriteString("\", ")
+	}
+	if tr.Priority != 0 {
+		buf.WriteString(fmt.Sprintf("priority: %d, ", tr.Priority))
+	}
+	if tr.Kind == TransitionInternal {
+		buf.WriteString("internal, ")
+	}
+	if tr.Else {
+		buf.WriteString("else, ")
+	}
 	if tr.Guard != nil {
 		buf.WriteString("has guard, ")
 	} else {
@@ -134,5 +231,8 @@ func (tr *Transition) Dump(buf *bytes.Buffer) {
 	} else {
 		buf.WriteString("no action")
 	}
+	if tr.Compensation != nil {
+		buf.WriteString(", has compensation")
+	}
 
 }
@@ -99,3 +99,15 @@ func TestTransitionValidate(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestNewEventTransition(t *testing.T) {
+	tr := NewEventTransition("name", "event", "to", nil, nil)
+	if tr.Event != "event" || tr.Guard == nil {
+		t.Log("Event transition should have an event and a default guard")
+		t.FailNow()
+	}
+	if tr.Validate() != nil {
+		t.Log("This transition should be valid")
+		t.FailNow()
+	}
+}